@@ -0,0 +1,84 @@
+// Copyright © 2024 Wei Shen <shenwei356@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package msa
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+)
+
+// ErrInvalidNames means the number of names does not match the number of sequences.
+var ErrInvalidNames error = fmt.Errorf("msa: the number of names does not match the number of sequences")
+
+// ClustalLineWidth is the number of columns in a line of Clustal format.
+var ClustalLineWidth = 60
+
+// WriteFASTA writes the alignment in aligned FASTA format, names are the names of sequences.
+func (aln *Alignment) WriteFASTA(w io.Writer, names []string) error {
+	if len(names) != len(aln.Rows) {
+		return ErrInvalidNames
+	}
+	bw := bufio.NewWriter(w)
+	for i, row := range aln.Rows {
+		fmt.Fprintf(bw, ">%s\n%s\n", names[i], row)
+	}
+	return bw.Flush()
+}
+
+// WriteClustal writes the alignment in Clustal format, names are the names of sequences.
+// In the conservation line, "*" means a column is fully conserved.
+func (aln *Alignment) WriteClustal(w io.Writer, names []string) error {
+	if len(names) != len(aln.Rows) {
+		return ErrInvalidNames
+	}
+	var width int
+	for _, name := range names {
+		width = max(width, len(name))
+	}
+	width += 6
+
+	bw := bufio.NewWriter(w)
+	bw.WriteString("CLUSTAL W multiple sequence alignment\n\n")
+
+	L := len(aln.Rows[0])
+	cons := make([]byte, 0, ClustalLineWidth)
+	for start := 0; start < L; start += ClustalLineWidth {
+		end := min(start+ClustalLineWidth, L)
+		bw.WriteString("\n")
+		for i, row := range aln.Rows {
+			fmt.Fprintf(bw, "%-*s%s\n", width, names[i], row[start:end])
+		}
+
+		cons = cons[:0]
+		for j := start; j < end; j++ {
+			cons = append(cons, '*')
+			for _, row := range aln.Rows {
+				if row[j] == gap || row[j] != aln.Rows[0][j] {
+					cons[len(cons)-1] = ' '
+					break
+				}
+			}
+		}
+		fmt.Fprintf(bw, "%-*s%s\n", width, "", cons)
+	}
+	return bw.Flush()
+}
@@ -0,0 +1,129 @@
+// Copyright © 2024 Wei Shen <shenwei356@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+// Package msa computes progressive multiple sequence alignments,
+// with a guide tree built from pairwise distances of the wfa package.
+package msa
+
+import (
+	"fmt"
+
+	"github.com/shenwei356/wfa"
+)
+
+// TreeMethod is the method to build the guide tree.
+type TreeMethod uint8
+
+const (
+	TreeUPGMA TreeMethod = iota // UPGMA
+	TreeNJ                      // neighbor joining
+)
+
+// Options contains the options of multiple sequence alignment.
+type Options struct {
+	// penalties for both pairwise distances and profile alignment,
+	// wfa.DefaultPenalties is used if nil.
+	Penalties *wfa.Penalties
+
+	AdaptiveReduction *wfa.AdaptiveReductionOption // for pairwise distances, nil for no adaptive reduction
+	Metric            wfa.DistanceMetric           // distance metric for the guide tree
+	Tree              TreeMethod                   // method to build the guide tree
+	Threads           int                          // the number of goroutines for pairwise distances, 0 for all CPUs
+}
+
+// DefaultOptions uses edit-distance-based identities and UPGMA.
+var DefaultOptions = &Options{
+	Penalties:         wfa.DefaultPenalties,
+	AdaptiveReduction: wfa.DefaultAdaptiveOption,
+	Metric:            wfa.DistanceEditDistanceIdentity,
+	Tree:              TreeUPGMA,
+}
+
+// ErrInvalidTreeMethod means the method of the guide tree is not supported.
+var ErrInvalidTreeMethod error = fmt.Errorf("msa: invalid tree method")
+
+// ErrNoSequences means no sequences are given.
+var ErrNoSequences error = fmt.Errorf("msa: no sequences given")
+
+// Alignment is a multiple sequence alignment.
+type Alignment struct {
+	Rows [][]byte // aligned sequences in the input order, gaps are represented by "-"
+	Tree *Tree    // the guide tree
+}
+
+// Align computes the multiple sequence alignment of sequences.
+// Pairwise distances are computed with WFA, then profiles are aligned progressively
+// following the guide tree, where the sum-of-pairs score with affine gaps is used.
+func Align(seqs [][]byte, opt *Options) (*Alignment, error) {
+	if len(seqs) == 0 {
+		return nil, ErrNoSequences
+	}
+	if opt == nil {
+		opt = DefaultOptions
+	}
+	if opt.Tree > TreeNJ {
+		return nil, ErrInvalidTreeMethod
+	}
+	p := opt.Penalties
+	if p == nil {
+		p = wfa.DefaultPenalties
+	}
+	for _, s := range seqs {
+		if len(s) == 0 {
+			return nil, wfa.ErrEmptySeq
+		}
+	}
+
+	var tree *Tree
+	if len(seqs) == 1 {
+		tree = &Tree{Leaf: 0}
+	} else {
+		m, err := wfa.PairwiseDistances(seqs, &wfa.DistanceOptions{
+			Penalties:         p,
+			Options:           &wfa.Options{GlobalAlignment: true},
+			AdaptiveReduction: opt.AdaptiveReduction,
+			Metric:            opt.Metric,
+			Threads:           opt.Threads,
+		})
+		if err != nil {
+			return nil, err
+		}
+		if opt.Tree == TreeNJ {
+			tree = NJ(m)
+		} else {
+			tree = UPGMA(m)
+		}
+	}
+
+	pf := progressive(tree, newAlphabet(seqs), seqs, p)
+	rows := make([][]byte, len(seqs))
+	for i, id := range pf.ids {
+		rows[id] = pf.rows[i]
+	}
+	return &Alignment{Rows: rows, Tree: tree}, nil
+}
+
+// progressive aligns profiles of the two children of each internal node, in post order.
+func progressive(t *Tree, ab *alphabet, seqs [][]byte, p *wfa.Penalties) *profile {
+	if t.Left == nil {
+		return newProfile(ab, t.Leaf, seqs[t.Leaf])
+	}
+	return alignProfiles(progressive(t.Left, ab, seqs, p), progressive(t.Right, ab, seqs, p), p)
+}
@@ -0,0 +1,82 @@
+package msa
+
+import (
+	"bytes"
+	"math/rand"
+	"strings"
+	"testing"
+)
+
+func randSeq(r *rand.Rand, n int) []byte {
+	s := make([]byte, n)
+	for i := range s {
+		s[i] = "ACGT"[r.Intn(4)]
+	}
+	return s
+}
+
+// mutate introduces substitutions, deletions and insertions with a given rate.
+func mutate(r *rand.Rand, s []byte, rate float64) []byte {
+	m := make([]byte, 0, len(s))
+	var x float64
+	for _, b := range s {
+		x = r.Float64()
+		switch {
+		case x < rate/3:
+			m = append(m, "ACGT"[r.Intn(4)])
+		case x < rate*2/3:
+		case x < rate:
+			m = append(m, b, "ACGT"[r.Intn(4)])
+		default:
+			m = append(m, b)
+		}
+	}
+	return m
+}
+
+func TestAlign(_t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	ref := randSeq(r, 300)
+	seqs := make([][]byte, 10)
+	names := make([]string, len(seqs))
+	for i := range seqs {
+		seqs[i] = mutate(r, ref, 0.05)
+		names[i] = "seq" + string(rune('0'+i))
+	}
+
+	for _, method := range []TreeMethod{TreeUPGMA, TreeNJ} {
+		aln, err := Align(seqs, &Options{Tree: method})
+		if err != nil {
+			_t.Error(err)
+			return
+		}
+
+		for i, row := range aln.Rows {
+			if len(row) != len(aln.Rows[0]) {
+				_t.Errorf("rows should have the same length")
+			}
+			if !bytes.Equal(bytes.ReplaceAll(row, []byte{'-'}, nil), seqs[i]) {
+				_t.Errorf("unexpected row %d: %s", i, row)
+			}
+		}
+		if n := strings.Count(aln.Tree.Newick(names), "seq"); n != len(seqs) {
+			_t.Errorf("unexpected number of leaves in the guide tree: %d", n)
+		}
+
+		// most columns should be conserved
+		var buf bytes.Buffer
+		if err = aln.WriteClustal(&buf, names); err != nil {
+			_t.Error(err)
+		}
+		if !strings.HasPrefix(buf.String(), "CLUSTAL") {
+			_t.Errorf("unexpected Clustal header")
+		}
+		if n := strings.Count(buf.String(), "*"); n < 200 {
+			_t.Errorf("too few conserved columns: %d", n)
+		}
+	}
+
+	if _, err := Align(seqs, &Options{Tree: 2}); err != ErrInvalidTreeMethod {
+		_t.Errorf("invalid tree method should be rejected")
+	}
+}
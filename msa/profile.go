@@ -0,0 +1,245 @@
+// Copyright © 2024 Wei Shen <shenwei356@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package msa
+
+import (
+	"math"
+
+	"github.com/shenwei356/wfa"
+)
+
+// gap is the gap character.
+const gap = '-'
+
+// alphabet maps characters to indexes, gaps are not included.
+type alphabet struct {
+	index [256]int
+	size  int
+}
+
+func newAlphabet(seqs [][]byte) *alphabet {
+	ab := &alphabet{}
+	for i := range ab.index {
+		ab.index[i] = -1
+	}
+	for _, s := range seqs {
+		for _, c := range s {
+			if ab.index[c] < 0 {
+				ab.index[c] = ab.size
+				ab.size++
+			}
+		}
+	}
+	return ab
+}
+
+// profile is a group of aligned sequences.
+type profile struct {
+	ids  []int    // indexes of sequences
+	rows [][]byte // aligned sequences
+
+	ab    *alphabet
+	freqs []float64 // frequencies of characters of columns, in a matrix of L x ab.size
+	gaps  []float64 // frequencies of gaps of columns
+}
+
+func newProfile(ab *alphabet, id int, s []byte) *profile {
+	pf := &profile{ids: []int{id}, rows: [][]byte{append([]byte{}, s...)}, ab: ab}
+	pf.count()
+	return pf
+}
+
+// count computes frequencies of characters of columns.
+func (pf *profile) count() {
+	L, K := len(pf.rows[0]), pf.ab.size
+	pf.freqs = make([]float64, L*K)
+	pf.gaps = make([]float64, L)
+
+	f := 1 / float64(len(pf.rows))
+	for _, row := range pf.rows {
+		for j, c := range row {
+			if c == gap {
+				pf.gaps[j] += f
+			} else {
+				pf.freqs[j*K+pf.ab.index[c]] += f
+			}
+		}
+	}
+}
+
+// directions of the traceback matrix, with 2 bits for each component.
+const (
+	fromM uint8 = iota
+	fromX
+	fromY
+)
+
+// alignProfiles aligns two profiles with the sum-of-pairs score and affine gap penalties.
+// In the component X, a column of a is aligned to a gap, and in Y, a column of b is aligned to a gap.
+func alignProfiles(a, b *profile, p *wfa.Penalties) *profile {
+	x, o, e := float64(p.Mismatch), float64(p.GapOpen), float64(p.GapExt)
+	n, m := len(a.gaps), len(b.gaps)
+
+	// the expected cost of aligning two characters from two columns,
+	// where two gaps cost nothing, and a gap and a character cost e.
+	K := a.ab.size
+	sub := func(i, j int) float64 {
+		fa, fb := a.freqs[i*K:(i+1)*K], b.freqs[j*K:(j+1)*K]
+		ga, gb := a.gaps[i], b.gaps[j]
+		var dot float64
+		for c, f := range fa {
+			dot += f * fb[c]
+		}
+		return x*((1-ga)*(1-gb)-dot) + e*(ga+gb-2*ga*gb)
+	}
+
+	inf := math.Inf(1)
+	w := m + 1
+	tb := make([]uint8, (n+1)*w)
+	M0, X0, Y0 := make([]float64, w), make([]float64, w), make([]float64, w)
+	M1, X1, Y1 := make([]float64, w), make([]float64, w), make([]float64, w)
+
+	// the first row: columns of b aligned to gaps
+	M0[0], X0[0], Y0[0] = 0, inf, inf
+	for j := 1; j <= m; j++ {
+		M0[j], X0[j] = inf, inf
+		if j == 1 {
+			Y0[j] = o + e*(1-b.gaps[0])
+		} else {
+			Y0[j] = Y0[j-1] + e*(1-b.gaps[j-1])
+			tb[j] = fromY << 4
+		}
+	}
+
+	var t, vM, vX, vY float64
+	var dM, dX, dY uint8
+	for i := 1; i <= n; i++ {
+		ea := e * (1 - a.gaps[i-1])
+		M1[0], Y1[0] = inf, inf
+		if i == 1 {
+			X1[0] = o + ea
+		} else {
+			X1[0] = X0[0] + ea
+			tb[i*w] = fromX << 2
+		}
+
+		for j := 1; j <= m; j++ {
+			// M
+			vM, dM = M0[j-1], fromM
+			if t = X0[j-1]; t < vM {
+				vM, dM = t, fromX
+			}
+			if t = Y0[j-1]; t < vM {
+				vM, dM = t, fromY
+			}
+			vM += sub(i-1, j-1)
+
+			// X: the column of a is aligned to a gap
+			vX, dX = M0[j]+o, fromM
+			if t = X0[j]; t < vX {
+				vX, dX = t, fromX
+			}
+			if t = Y0[j] + o; t < vX {
+				vX, dX = t, fromY
+			}
+			vX += ea
+
+			// Y: the column of b is aligned to a gap
+			vY, dY = M1[j-1]+o, fromM
+			if t = X1[j-1] + o; t < vY {
+				vY, dY = t, fromX
+			}
+			if t = Y1[j-1]; t < vY {
+				vY, dY = t, fromY
+			}
+			vY += e * (1 - b.gaps[j-1])
+
+			M1[j], X1[j], Y1[j] = vM, vX, vY
+			tb[i*w+j] = dM | dX<<2 | dY<<4
+		}
+		M0, M1 = M1, M0
+		X0, X1 = X1, X0
+		Y0, Y1 = Y1, Y0
+	}
+
+	// traceback
+	state := fromM
+	if X0[m] < M0[m] {
+		state = fromX
+	}
+	if Y0[m] < M0[m] && Y0[m] < X0[m] {
+		state = fromY
+	}
+	ops := make([]uint8, 0, n+m)
+	i, j := n, m
+	for i > 0 || j > 0 {
+		ops = append(ops, state)
+		d := tb[i*w+j]
+		switch state {
+		case fromM:
+			state = d & 3
+			i--
+			j--
+		case fromX:
+			state = d >> 2 & 3
+			i--
+		default:
+			state = d >> 4 & 3
+			j--
+		}
+	}
+
+	// merging rows
+	L := len(ops)
+	pf := &profile{
+		ids:  append(append(make([]int, 0, len(a.ids)+len(b.ids)), a.ids...), b.ids...),
+		rows: make([][]byte, 0, len(a.rows)+len(b.rows)),
+		ab:   a.ab,
+	}
+	for _, row := range a.rows {
+		r := make([]byte, 0, L)
+		i = 0
+		for k := L - 1; k >= 0; k-- {
+			if ops[k] == fromY {
+				r = append(r, gap)
+			} else {
+				r = append(r, row[i])
+				i++
+			}
+		}
+		pf.rows = append(pf.rows, r)
+	}
+	for _, row := range b.rows {
+		r := make([]byte, 0, L)
+		j = 0
+		for k := L - 1; k >= 0; k-- {
+			if ops[k] == fromX {
+				r = append(r, gap)
+			} else {
+				r = append(r, row[j])
+				j++
+			}
+		}
+		pf.rows = append(pf.rows, r)
+	}
+	pf.count()
+	return pf
+}
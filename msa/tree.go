@@ -0,0 +1,178 @@
+// Copyright © 2024 Wei Shen <shenwei356@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package msa
+
+import (
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/shenwei356/wfa"
+)
+
+// Tree is a rooted binary tree, of which the leaves are sequences.
+type Tree struct {
+	Left, Right *Tree
+	Leaf        int     // index of the sequence for leaves, -1 for internal nodes
+	Length      float64 // length of the branch to the parent
+}
+
+// distances copies a distance matrix into a full square matrix.
+func distances(m *wfa.DistanceMatrix) [][]float64 {
+	d := make([][]float64, m.N)
+	for i := range d {
+		d[i] = make([]float64, m.N)
+		for j := range d[i] {
+			d[i][j] = m.Get(i, j)
+		}
+	}
+	return d
+}
+
+// UPGMA builds an ultrametric tree with the UPGMA method.
+func UPGMA(m *wfa.DistanceMatrix) *Tree {
+	d := distances(m)
+	n := m.N
+	nodes := make([]*Tree, n)
+	sizes := make([]int, n)
+	heights := make([]float64, n)
+	for i := range nodes {
+		nodes[i] = &Tree{Leaf: i}
+		sizes[i] = 1
+	}
+
+	var a, b int
+	var best float64
+	for r := n; r > 1; r-- {
+		// the closest pair of clusters
+		a, b, best = -1, -1, math.Inf(1)
+		for i := 0; i < n; i++ {
+			if nodes[i] == nil {
+				continue
+			}
+			for j := i + 1; j < n; j++ {
+				if nodes[j] != nil && d[i][j] < best {
+					a, b, best = i, j, d[i][j]
+				}
+			}
+		}
+
+		h := best / 2
+		nodes[a].Length = math.Max(0, h-heights[a])
+		nodes[b].Length = math.Max(0, h-heights[b])
+		nodes[a] = &Tree{Left: nodes[a], Right: nodes[b], Leaf: -1}
+		nodes[b] = nil
+
+		// the new cluster is stored in a
+		for k := 0; k < n; k++ {
+			if nodes[k] == nil || k == a {
+				continue
+			}
+			d[a][k] = (d[a][k]*float64(sizes[a]) + d[b][k]*float64(sizes[b])) / float64(sizes[a]+sizes[b])
+			d[k][a] = d[a][k]
+		}
+		sizes[a] += sizes[b]
+		heights[a] = h
+	}
+	return nodes[0]
+}
+
+// NJ builds a tree with the neighbor-joining method, which is rooted at the last join.
+func NJ(m *wfa.DistanceMatrix) *Tree {
+	d := distances(m)
+	n := m.N
+	nodes := make([]*Tree, n)
+	for i := range nodes {
+		nodes[i] = &Tree{Leaf: i}
+	}
+	active := make([]int, n) // indexes of remaining nodes
+	for i := range active {
+		active[i] = i
+	}
+	sums := make([]float64, n)
+
+	var a, b, x, y int
+	var q, best float64
+	for len(active) > 2 {
+		r := float64(len(active))
+		for _, i := range active {
+			sums[i] = 0
+			for _, j := range active {
+				sums[i] += d[i][j]
+			}
+		}
+
+		// the pair minimizing the Q criterion
+		a, b, best = -1, -1, math.Inf(1)
+		for x = 0; x < len(active); x++ {
+			for y = x + 1; y < len(active); y++ {
+				i, j := active[x], active[y]
+				if q = (r-2)*d[i][j] - sums[i] - sums[j]; q < best {
+					a, b, best = x, y, q
+				}
+			}
+		}
+		i, j := active[a], active[b]
+		li := d[i][j]/2 + (sums[i]-sums[j])/(2*(r-2))
+		nodes[i].Length = math.Max(0, li)
+		nodes[j].Length = math.Max(0, d[i][j]-li)
+		nodes[i] = &Tree{Left: nodes[i], Right: nodes[j], Leaf: -1}
+
+		// the new node is stored in i
+		for _, k := range active {
+			if k != i && k != j {
+				d[i][k] = (d[i][k] + d[j][k] - d[i][j]) / 2
+				d[k][i] = d[i][k]
+			}
+		}
+		active = append(active[:b], active[b+1:]...)
+	}
+
+	if len(active) == 1 {
+		return nodes[active[0]]
+	}
+	i, j := active[0], active[1]
+	nodes[i].Length = math.Max(0, d[i][j]/2)
+	nodes[j].Length = nodes[i].Length
+	return &Tree{Left: nodes[i], Right: nodes[j], Leaf: -1}
+}
+
+// Newick returns the tree in Newick format, names are the names of sequences.
+func (t *Tree) Newick(names []string) string {
+	var sb strings.Builder
+	t.newick(&sb, names)
+	sb.WriteByte(';')
+	return sb.String()
+}
+
+func (t *Tree) newick(sb *strings.Builder, names []string) {
+	if t.Left == nil {
+		sb.WriteString(names[t.Leaf])
+	} else {
+		sb.WriteByte('(')
+		t.Left.newick(sb, names)
+		sb.WriteByte(',')
+		t.Right.newick(sb, names)
+		sb.WriteByte(')')
+	}
+	sb.WriteByte(':')
+	sb.WriteString(strconv.FormatFloat(t.Length, 'g', 6, 64))
+}
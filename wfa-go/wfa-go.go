@@ -22,6 +22,7 @@ package main
 
 import (
 	"bufio"
+	"bytes"
 	"flag"
 	"fmt"
 	"os"
@@ -59,8 +60,12 @@ Usage:
 
         %s [options] -i input.txt
 
+  3. Compute an all-vs-all distance matrix of sequences in a FASTA file.
+
+        %s [options] -matrix phylip -i seqs.fasta
+
 Options/Flags:
-`, version, app, app)
+`, version, app, app, app)
 
 	flag.Usage = func() {
 		fmt.Fprint(os.Stderr, usage)
@@ -73,6 +78,15 @@ Options/Flags:
 	noAdaptive := flag.Bool("a", false, "do not use adaptive reduction")
 	noOutput := flag.Bool("N", false, "do not output alignment (for benchmark)")
 	trim := flag.Bool("t", false, "only show the aligned region")
+	vcf := flag.Bool("vcf", false, "output variants in VCF format, with the target as the reference")
+	width := flag.Int("width", 0, "line width of wrapped alignment text, 0 for no wrapping")
+	color := flag.Bool("color", false, "highlight mismatches with ANSI colour")
+	showStats := flag.Bool("stats", false, "print stats of the work of each alignment to stderr")
+	matrix := flag.String("matrix", "", "output an all-vs-all distance matrix of sequences in the FASTA file (-i), "+
+		"available formats: phylip, tsv")
+	metric := flag.String("metric", "score", "distance metric for -matrix, available values: "+
+		"score, identity, gc-identity, ed-identity")
+	threads := flag.Int("j", 0, "number of threads for -matrix, 0 for all CPUs")
 
 	pprofCPU := flag.Bool("p", false, "cpu pprof. go tool pprof -http=:8080 cpu.pprof")
 	pprofMem := flag.Bool("m", false, "mem pprof. go tool pprof -http=:8080 mem.pprof")
@@ -93,24 +107,89 @@ Options/Flags:
 
 	outfh := bufio.NewWriter(os.Stdout)
 
-	algn := wfa.New(wfa.DefaultPenalties, &wfa.Options{
+	opt := &wfa.Options{
 		GlobalAlignment: !*noGlobal,
-	})
-
+	}
+	var ar *wfa.AdaptiveReductionOption
 	if !*noAdaptive {
-		algn.AdaptiveReduction(&wfa.AdaptiveReductionOption{
+		ar = &wfa.AdaptiveReductionOption{
 			MinWFLen:    10,
 			MaxDistDiff: 50,
 			CutoffStep:  1,
+		}
+	}
+
+	// distance matrix
+
+	if *matrix != "" {
+		defer outfh.Flush()
+
+		if *infile == "" {
+			checkError(fmt.Errorf("flag -i needed for -matrix"))
+		}
+		if *matrix != "phylip" && *matrix != "tsv" {
+			checkError(fmt.Errorf("invalid matrix format: %s", *matrix))
+		}
+		metrics := map[string]wfa.DistanceMetric{
+			"score":       wfa.DistanceScore,
+			"identity":    wfa.DistanceBLASTIdentity,
+			"gc-identity": wfa.DistanceGapCompressedIdentity,
+			"ed-identity": wfa.DistanceEditDistanceIdentity,
+		}
+		_metric, ok := metrics[*metric]
+		if !ok {
+			checkError(fmt.Errorf("invalid distance metric: %s", *metric))
+		}
+
+		names, seqs, err := readFasta(*infile)
+		checkError(err)
+
+		m, err := wfa.PairwiseDistances(seqs, &wfa.DistanceOptions{
+			Options:           opt,
+			AdaptiveReduction: ar,
+			Metric:            _metric,
+			Threads:           *threads,
 		})
+		checkError(err)
+
+		if *noOutput {
+			return
+		}
+		if *matrix == "phylip" {
+			checkError(m.WritePHYLIP(outfh, names))
+		} else {
+			checkError(m.WriteTSV(outfh, names))
+		}
+		return
+	}
+
+	algn := wfa.New(wfa.DefaultPenalties, opt)
+
+	if ar != nil {
+		algn.AdaptiveReduction(ar)
+	}
+
+	var stats wfa.AlignerStats
+	if *showStats {
+		algn.CollectStats(&stats)
 	}
 
+	// VCF records are buffered, as the header needs all the targets.
+	var vcfBuf bytes.Buffer
+	var contigs []wfa.VCFContig
+
 	defer func() {
 		wfa.RecycleAligner(algn)
+		if *vcf && !*noOutput {
+			checkError(wfa.WriteVCFHeader(outfh, contigs...))
+			outfh.Write(vcfBuf.Bytes())
+		}
 		outfh.Flush()
 	}()
 
+	var nPairs int
 	falign2Seq := func(q, t string) {
+		nPairs++
 
 		_q, _t := []byte(q), []byte(t)
 		result, err := algn.Align(_q, _t)
@@ -118,7 +197,30 @@ Options/Flags:
 			checkError(err)
 		}
 
-		if !*noOutput {
+		if *showStats {
+			fmt.Fprintf(os.Stderr, "pair %d, steps: %d, wavefronts: %d, cells: %d, bases compared: %d, "+
+				"pruned diagonals: %d, peak memory: %d bytes\n",
+				nPairs, stats.Steps, stats.WaveFronts, stats.Cells, stats.BasesCompared,
+				stats.PrunedDiagonals, stats.PeakMemory)
+			stats.Reset()
+		}
+
+		if *vcf {
+			if !*noOutput {
+				chrom := fmt.Sprintf("target%d", nPairs)
+				contigs = append(contigs, wfa.VCFContig{ID: chrom, Length: len(_t)})
+				checkError(wfa.WriteVCF(&vcfBuf, chrom, result.Variants(&_q, &_t)))
+			}
+		} else if !*noOutput && (*width > 0 || *color) {
+			checkError(result.WriteAlignment(outfh, &_q, &_t, &wfa.FormatOptions{
+				Width:             *width,
+				Symbols:           true,
+				Color:             *color,
+				OnlyAlignedRegion: *trim,
+			}))
+			fmt.Fprintf(outfh, "cigar: %s\n", result.CIGAR(*trim))
+			fmt.Fprintln(outfh)
+		} else if !*noOutput {
 			Q, A, T := result.AlignmentText(&_q, &_t, *trim)
 
 			// fmt.Fprintln(outfh, q, t)
@@ -182,6 +284,45 @@ Options/Flags:
 
 }
 
+// readFasta reads all sequences from a FASTA file, only the IDs are kept as names.
+func readFasta(file string) ([]string, [][]byte, error) {
+	fh, err := os.Open(file)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to read file: %s", file)
+	}
+	defer fh.Close()
+
+	names := make([]string, 0, 8)
+	seqs := make([][]byte, 0, 8)
+	scanner := bufio.NewScanner(fh)
+	scanner.Buffer(make([]byte, 0, 1<<20), 1<<30)
+	var line []byte
+	for scanner.Scan() {
+		line = bytes.TrimSpace(scanner.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+		if line[0] == '>' {
+			fields := bytes.Fields(line[1:])
+			if len(fields) == 0 {
+				names = append(names, "")
+			} else {
+				names = append(names, string(fields[0]))
+			}
+			seqs = append(seqs, []byte{})
+			continue
+		}
+		if len(seqs) == 0 {
+			return nil, nil, fmt.Errorf("invalid FASTA file: %s", file)
+		}
+		seqs[len(seqs)-1] = append(seqs[len(seqs)-1], line...)
+	}
+	if err = scanner.Err(); err != nil {
+		return nil, nil, fmt.Errorf("something wrong in reading file: %s", file)
+	}
+	return names, seqs, nil
+}
+
 func checkError(err error) {
 	if err != nil {
 		fmt.Fprintln(os.Stderr, err)
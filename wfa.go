@@ -21,10 +21,8 @@
 package wfa
 
 import (
-	"encoding/binary"
 	"fmt"
 	"math"
-	"math/bits"
 	"sync"
 )
 
@@ -63,6 +61,10 @@ var DefaultAdaptiveOption = &AdaptiveReductionOption{
 // Currently it only support global or semi-global alignment.
 type Options struct {
 	GlobalAlignment bool
+
+	// IndelAlignment decides where to place indels which have several equivalent positions.
+	// It does not change the alignment score.
+	IndelAlignment IndelAlignment
 }
 
 // DefaultOptions is the default option
@@ -84,6 +86,35 @@ type Aligner struct {
 	opt *Options
 
 	M, I, D *Component
+
+	qp *QualityPenalties   // quality-aware mismatch penalties
+	rp *RepeatGapPenalties // gap penalties in repeats
+
+	// position-specific penalties of the current alignment.
+	mis   *posPenalties // mismatch penalties of query positions, only in AlignWithQuality()
+	gaps  *gapPenalties // gap penalties of all positions, only if rp is not nil
+	_mis  posPenalties
+	_gaps gapPenalties
+
+	lastMis *posPenalties // mismatch penalties of the last alignment, kept for Plot()
+
+	// buffers of penalties in Rescore(), so the ones of the last alignment are not changed.
+	_rmis  posPenalties
+	_rgaps gapPenalties
+
+	// alignment stops when the score exceeds it, only used in AlignOneToMany() for now.
+	maxScore uint32
+
+	// diagonals deleted in adaptive reduction, only recorded if recordPruned is true.
+	recordPruned bool
+	pruned       []prunedDiagonal
+
+	stats    *AlignerStats              // counters of the work, only if it is not nil
+	observer func(s uint32, lo, hi int) // called after each score step
+
+	_bytes   byteSeqs // for avoiding allocation
+	_matcher matcherSeqs
+	_packed  packedSeqs
 }
 
 // object pool of aligners.
@@ -111,6 +142,11 @@ func RecycleAligner(algn *Aligner) {
 		// algn.I = nil
 		// algn.D = nil
 
+		// but release memory used by long alignments.
+		algn.M.trim()
+		algn.I.trim()
+		algn.D.trim()
+
 		poolAligner.Put(algn)
 	}
 }
@@ -121,6 +157,12 @@ func New(p *Penalties, opt *Options) *Aligner {
 	algn := poolAligner.Get().(*Aligner)
 	algn.p = p
 	algn.opt = opt
+	algn.qp = nil
+	algn.rp = nil
+	algn.maxScore = math.MaxUint32
+	algn.recordPruned = false
+	algn.stats = nil
+	algn.observer = nil
 
 	// there's no need to recyle them, just leave them with the aligner.
 	// algn.M = NewComponent()
@@ -140,42 +182,46 @@ func (algn *Aligner) AdaptiveReduction(ad *AdaptiveReductionOption) error {
 }
 
 // initComponents resets the internal data before each alignment.
-func (algn *Aligner) initComponents(q, t *[]byte) {
+func (algn *Aligner) initComponents(seqs sequences) {
 	// clear all wavefronts
 	algn.M.Reset()
 	algn.I.Reset()
 	algn.D.Reset()
+	algn.pruned = algn.pruned[:0]
 
-	m, n := len(*t), len(*q)
+	n, m := seqs.lens()
 	M := algn.M
+	if !algn.opt.GlobalAlignment {
+		M.setKRangeHint(-(n - 1), m-1)
+	}
 
 	var wfaType, score uint32
 
 	// have to check the first bases
-	if (*q)[0] == (*t)[0] { // M[0,0] = 0
+	if seqs.equal(0, 0) { // M[0,0] = 0
 		wfaType, score = wfaMatch, 0
 	} else { // M[0,0] = 4
-		wfaType, score = wfaMismatch, algn.p.Mismatch
+		wfaType, score = wfaMismatch, algn.mismatchPenalty(1)
 	}
 	M.Set(score, 0, 1, wfaType)
 
 	// for semi-global alignment
 	if !algn.opt.GlobalAlignment {
 		for k := 1; k < m; k++ { // first row
-			if (*q)[0] == (*t)[k] {
+			if seqs.equal(0, k) {
 				wfaType, score = wfaMatch, 0
 			} else {
-				wfaType, score = wfaMismatch, algn.p.Mismatch
+				wfaType, score = wfaMismatch, algn.mismatchPenalty(1)
 			}
 
 			M.Set(score, k, uint32(k+1), wfaType)
 		}
 
 		for k := 1; k < n; k++ { // first column
-			if (*q)[k] == (*t)[0] {
+			if seqs.equal(k, 0) {
 				wfaType, score = wfaMatch, 0
 			} else {
-				wfaType, score = wfaMismatch, algn.p.Mismatch
+				wfaType, score = wfaMismatch, algn.mismatchPenalty(k+1)
 			}
 
 			M.Set(score, -k, 1, wfaType)
@@ -192,6 +238,9 @@ const MaxSeqLen int = 1<<(32-wfaTypeBits) - 1
 // ErrSeqTooLong means the sequence is too long.
 var ErrSeqTooLong error = fmt.Errorf("wfa: sequences longer than %d are not supported", MaxSeqLen)
 
+// errScoreExceeded means the alignment score exceeds the threshold.
+var errScoreExceeded error = fmt.Errorf("wfa: alignment score exceeds the threshold")
+
 // Align performs alignment with two sequences.
 func (algn *Aligner) Align(q, t []byte) (*AlignmentResult, error) {
 	return algn.AlignPointers(&q, &t)
@@ -199,16 +248,51 @@ func (algn *Aligner) Align(q, t []byte) (*AlignmentResult, error) {
 
 // AlignPointers performs alignment with two sequences. The arguments are pointers.
 func (algn *Aligner) AlignPointers(q, t *[]byte) (*AlignmentResult, error) {
-	m, n := len(*t), len(*q)
+	return algn.align(algn.bytes(q, t))
+}
+
+// bytes wraps two byte sequences.
+func (algn *Aligner) bytes(q, t *[]byte) sequences {
+	algn._bytes.q, algn._bytes.t = *q, *t
+	return &algn._bytes
+}
+
+// align performs alignment with two sequences.
+func (algn *Aligner) align(seqs sequences) (*AlignmentResult, error) {
+	minS, lastK, err := algn.compute(seqs)
+	if err != nil {
+		return nil, err
+	}
+
+	cigar := algn.backTrace(seqs, minS, lastK)
+
+	if algn.opt.IndelAlignment != IndelAsIs {
+		var gapPenalty func(uint32, int, int) uint32
+		if algn.gaps != nil {
+			gapPenalty = algn.gapPenalty
+		}
+		cigar.normalizeIndels(seqs.equal, algn.opt.IndelAlignment == IndelLeftAligned, gapPenalty)
+	}
+
+	return cigar, nil
+}
+
+// compute computes the wavefronts, and returns the alignment score and the diagonal
+// of the backtrace start position.
+func (algn *Aligner) compute(seqs sequences) (uint32, int, error) {
+	n, m := seqs.lens()
 
 	if n == 0 || m == 0 {
-		return nil, ErrEmptySeq
+		return 0, 0, ErrEmptySeq
 	}
 	if n > MaxSeqLen || m > MaxSeqLen {
-		return nil, ErrSeqTooLong
+		return 0, 0, ErrSeqTooLong
 	}
 
-	algn.initComponents(q, t)
+	algn.gaps = algn.prepareGaps(seqs, &algn._gaps)
+	algn.lastMis = algn.mis
+
+	algn.initComponents(seqs)
 
 	// -------------------------------------------------
 
@@ -225,29 +309,53 @@ func (algn *Aligner) AlignPointers(q, t *[]byte) (*AlignmentResult, error) {
 	if reduce {
 		minWFLen = int(algn.ad.MinWFLen)
 	}
+	var found bool
+	if algn.stats != nil {
+		defer algn.updateStats()
+	}
 	for {
 		// fmt.Printf("---------------------- s: %-3d ----------------------\n", s)
 		if M.HasScore(s) {
 			// fmt.Printf("extend:\n")
-			lo, hi = algn.extend(q, t, s)
+			lo, hi = algn.extend(seqs, s)
 			// fmt.Printf("max offset: %d, Aoffset: %d\n", (*(*M)[s])[Ak], Aoffset)
 
 			offset, _, _ = M.GetAfterDiff(s, 0, Ak)
-			if offset >= Aoffset { // reached the end
-				// fmt.Printf("reach end, s:%d, k:%d, offset:%d, Aoffset:%d\n", s, Ak, offset>>wfaTypeBits, Aoffset)
-				break
-			}
+			end := offset >= Aoffset // reached the end
 
 			// fmt.Printf("reduce:\n")
-			if reduce && hi-lo+1 >= minWFLen {
-				algn.reduce(q, t, s)
+			if !end && reduce && hi-lo+1 >= minWFLen {
+				algn.reduce(seqs, s)
+			}
+
+			if algn.stats != nil {
+				algn.stats.Steps++
+			}
+			if algn.observer != nil {
+				wf := M.WaveFronts[s]
+				algn.observer(s, wf.Lo, wf.Hi)
+			}
+			if end {
+				break
 			}
 		}
 
 		s++
 
+		if s > algn.maxScore {
+			if algn.opt.GlobalAlignment {
+				return 0, 0, errScoreExceeded
+			}
+			// the last row/column might have been reached with a lower score.
+			s--
+			if _, _, found = algn.backtraceStartPosistion(seqs, s); !found {
+				return 0, 0, errScoreExceeded
+			}
+			break
+		}
+
 		// fmt.Printf("next:\n")
-		algn.next(q, t, s)
+		algn.next(seqs, s)
 	}
 
 	// M.Print(os.Stdout, "M")
@@ -256,20 +364,17 @@ func (algn *Aligner) AlignPointers(q, t *[]byte) (*AlignmentResult, error) {
 	minS, lastK := s, Ak
 	// fmt.Printf("min s:%d, k:%d\n", minS, lastK)
 	if !algn.opt.GlobalAlignment { // find the minimum score on the last row/column
-		minS, lastK = algn.backtraceStartPosistion(q, t, s)
+		minS, lastK, _ = algn.backtraceStartPosistion(seqs, s)
 		// fmt.Printf("new min s:%d, k:%d\n", minS, lastK)
 	}
-	// offset, _, _ = M.Get(minS, 0, lastK)
-	// h := offset
-	// v := h - uint32(lastK)
-	// fmt.Printf("min s:%d, k:%d, h:%d, v:%d\n", minS, lastK, h, v)
-
-	return algn.backTrace(q, t, minS, lastK), nil
+	return minS, lastK, nil
 }
 
-func (algn *Aligner) backtraceStartPosistion(q, t *[]byte, s uint32) (uint32, int) {
+// backtraceStartPosistion finds the minimum score on the last row/column.
+// The bool value indicates whether such a cell is found.
+func (algn *Aligner) backtraceStartPosistion(seqs sequences, s uint32) (uint32, int, bool) {
 	M := algn.M
-	m, n := len(*t), len(*q)
+	n, m := seqs.lens()
 	minS := s
 	Ak := m - n
 	lastK := Ak
@@ -280,6 +385,7 @@ func (algn *Aligner) backtraceStartPosistion(q, t *[]byte, s uint32) (uint32, in
 	var lastRowOrCol bool
 	var h, v int
 	var lo, hi int
+	var found bool
 
 	// algn.Plot(q, t, os.Stdout, algn.M, true, -1)
 	// fmt.Printf("m: %d, n: %d\n", m, n)
@@ -328,6 +434,7 @@ func (algn *Aligner) backtraceStartPosistion(q, t *[]byte, s uint32) (uint32, in
 		if lastRowOrCol && _s <= minS {
 			lastK = k
 			minS = _s
+			found = true
 		}
 
 		lastRowOrCol = false
@@ -363,6 +470,7 @@ func (algn *Aligner) backtraceStartPosistion(q, t *[]byte, s uint32) (uint32, in
 		if lastRowOrCol && _s <= minS {
 			lastK = k
 			minS = _s
+			found = true
 		}
 
 		if _s == 0 {
@@ -371,24 +479,26 @@ func (algn *Aligner) backtraceStartPosistion(q, t *[]byte, s uint32) (uint32, in
 	}
 
 	// fmt.Printf("min s:%d, lastk:%d\n", minS, lastK)
-	return minS, lastK
+	return minS, lastK, found
 }
 
-var be = binary.BigEndian
-
 // extend refers to the WF_EXTEND method.
-// The return bool value indicates whether the end of one sequence is reached.
-func (algn *Aligner) extend(q, t *[]byte, s uint32) (int, int) {
+func (algn *Aligner) extend(seqs sequences, s uint32) (int, int) {
 	wf := algn.M.WaveFronts[s]
 	lo, hi := wf.Lo, wf.Hi
 	// fmt.Printf("  lo: %d, hi: %d, offsets: %d\n", lo, hi, *offsets)
 
 	var offset uint32
 	var v, h int
-	lenQ := len(*q)
-	lenT := len(*t)
-	var q8, t8 uint64
-	var n, N int
+	lenQ, lenT := seqs.lens()
+	var N int
+	bs, _ := seqs.(*byteSeqs)
+	ps, _ := seqs.(*packedSeqs)
+	if ps != nil && lo <= hi {
+		algn.extendPacked(ps, wf)
+		return lo, hi
+	}
+	stats := algn.stats
 
 	var ok bool
 	for k := hi; k >= lo; k-- {
@@ -406,51 +516,19 @@ func (algn *Aligner) extend(q, t *[]byte, s uint32) (int, int) {
 		}
 
 		// offset is 1-based, here it's checking the base in the next position.
-
-		// compare every 8 bases, convert 8 bases to a uint64, xor them and count leading zeroes.
-		if v+8 <= lenQ && h+8 <= lenT {
-			N = 0
-			// fmt.Printf("      block wise, start from: h: %d, v: %d\n", h, v)
-			for {
-				q8, t8 = be.Uint64((*q)[v:v+8]), be.Uint64((*t)[h:h+8])
-				n = bits.LeadingZeros64(q8^t8) >> 3 // divide 8
-				v += n
-				h += n
-				N += n
-				if n < 8 || v+8 >= lenQ || h+8 >= lenT {
-					break
-				}
-			}
-			if N == 0 {
-				continue
-			}
-
-			// fmt.Printf("        block wise, %d matches\n", N)
-			wf.Increase(k, uint32(N))
-
-			if !(n == 8 && v < lenQ && h < lenT) {
-				continue
-			}
-			// fmt.Printf("         need to check left ------------------------------ \n")
+		if bs != nil { // avoid the dynamic dispatch for the default byte sequences
+			N = bs.extend(v, h)
+		} else {
+			N = seqs.extend(v, h)
 		}
-
-		// compare each base
-
-		N = 0
-		for (*q)[v] == (*t)[h] {
-			v++
-			h++
-			N++
-
-			if v == lenQ || h == lenT {
-				break
-			}
+		if stats != nil { // the matched bases and a mismatched one
+			stats.BasesCompared += min(N+1, lenQ-v, lenT-h)
 		}
 		if N == 0 {
 			continue
 		}
 
-		// fmt.Printf("      byte wise: k: %d, extend to h: %d, v: %d\n", k, h, v)
+		// fmt.Printf("      k: %d, extend to h: %d, v: %d\n", k, h+N, v+N)
 		wf.Increase(k, uint32(N))
 	}
 
@@ -458,13 +536,12 @@ func (algn *Aligner) extend(q, t *[]byte, s uint32) (int, int) {
 }
 
 // adaptive reduction
-func (algn *Aligner) reduce(q, t *[]byte, s uint32) {
+func (algn *Aligner) reduce(seqs sequences, s uint32) {
 	wf := algn.M.WaveFronts[s] // previously, we've checked. M.HasScore(s)
 	lo, hi := wf.Lo, wf.Hi
 	var offset uint32
 	var v, h int
-	lenQ := len(*q)
-	lenT := len(*t)
+	lenQ, lenT := seqs.lens()
 	var ok bool
 
 	var d, minDist int
@@ -523,6 +600,18 @@ func (algn *Aligner) reduce(q, t *[]byte, s uint32) {
 		}
 	}
 
+	if algn.stats != nil {
+		algn.stats.PrunedDiagonals += _lo - lo + hi - _hi
+	}
+	if algn.recordPruned {
+		for k := lo; k < _lo; k++ {
+			algn.recordPrunedDiagonal(wf, s, k)
+		}
+		for k := _hi + 1; k <= hi; k++ {
+			algn.recordPrunedDiagonal(wf, s, k)
+		}
+	}
+
 	for k := lo; k < _lo; k++ {
 		wf.Delete(k)
 		I.Delete(s, k)
@@ -539,6 +628,26 @@ func (algn *Aligner) reduce(q, t *[]byte, s uint32) {
 	poolDist.Put(ds)
 }
 
+// prunedDiagonal is a diagonal deleted in adaptive reduction.
+type prunedDiagonal struct {
+	s      uint32
+	k      int
+	offset uint32
+}
+
+// RecordPruned decides whether to record diagonals deleted in adaptive reduction,
+// which are shown in PlotSVG().
+func (algn *Aligner) RecordPruned(record bool) {
+	algn.recordPruned = record
+}
+
+// recordPrunedDiagonal records a diagonal of M before it is deleted.
+func (algn *Aligner) recordPrunedDiagonal(wf *WaveFront, s uint32, k int) {
+	if offset, _, ok := wf.Get(k); ok {
+		algn.pruned = append(algn.pruned, prunedDiagonal{s: s, k: k, offset: offset})
+	}
+}
+
 // poolDist is used in reduce()
 var poolDist = &sync.Pool{New: func() interface{} {
 	tmp := make([]int, 0, 128)
@@ -546,23 +655,46 @@ var poolDist = &sync.Pool{New: func() interface{} {
 }}
 
 // next refers to the WF_NEXT method.
-func (algn *Aligner) next(q, t *[]byte, s uint32) {
+func (algn *Aligner) next(seqs sequences, s uint32) {
 	M := algn.M
 	I := algn.I
 	D := algn.D
 	p := algn.p
-	lenQ := len(*q)
-	lenT := len(*t)
+	fixedGaps := algn.gaps == nil
+	lenQ, lenT := seqs.lens()
 
-	loMismatch, hiMismatch := M.KRange(s, p.Mismatch)       // M[s-x]
-	loGapOpen, hiGapOpen := M.KRange(s, p.GapOpen+p.GapExt) // M[s-o-e]
-	loInsert, hiInsert := I.KRange(s, p.GapExt)             // I[s-e]
-	loDelete, hiDelete := D.KRange(s, p.GapExt)             // D[s-e]
+	loMismatch, hiMismatch := algn.mismatchKRange(s) // M[s-x]
+	// M[s-o-e], I[s-e], D[s-e]
+	loGapOpen, hiGapOpen, loInsert, hiInsert, loDelete, hiDelete := algn.gapKRanges(s)
 
 	hi := min(int(lenT-1), max(hiMismatch, hiGapOpen, hiInsert, hiDelete)+1)
 	lo := max(-int(lenQ-1), min(loMismatch, loGapOpen, loInsert, loDelete)-1)
 
 	// fmt.Printf("s: %d, k: %d -> %d, lenQ: %d, lenT: %d\n", s, lo, hi, lenQ, lenT)
+	if algn.stats != nil && hi >= lo {
+		algn.stats.Cells += hi - lo + 1
+	}
+
+	// new wavefronts are allocated with this k range
+	M.setKRangeHint(lo, hi)
+	I.setKRangeHint(lo, hi)
+	D.setKRangeHint(lo, hi)
+
+	// wavefronts of sources and destinations, so we do not need to look up them for each k.
+	M.reserve(s)
+	I.reserve(s)
+	D.reserve(s)
+	var wfM0, wfI0, wfD0, wfX0 *WaveFront
+	if fixedGaps {
+		wfM0 = M.waveFrontAfterDiff(s, p.GapOpen+p.GapExt) // M[s-o-e]
+		wfI0 = I.waveFrontAfterDiff(s, p.GapExt)           // I[s-e]
+		wfD0 = D.waveFrontAfterDiff(s, p.GapExt)           // D[s-e]
+	}
+	fixedMismatch := algn.mis == nil
+	if fixedMismatch {
+		wfX0 = M.waveFrontAfterDiff(s, p.Mismatch) // M[s-x]
+	}
+	var wfM, wfI, wfD *WaveFront
 
 	var fromI, fromD, fromM bool
 	var v1, v2 uint32
@@ -576,8 +708,12 @@ func (algn *Aligner) next(q, t *[]byte, s uint32) {
 
 		// --------------------------------------
 		// insertion: 🠦
-		v1, _, fromM = M.GetAfterDiff(s, p.GapOpen+p.GapExt, k-1)
-		v2, _, fromI = I.GetAfterDiff(s, p.GapExt, k-1)
+		if fixedGaps {
+			v1, _, fromM = wfM0.Get(k - 1)
+			v2, _, fromI = wfI0.Get(k - 1)
+		} else {
+			v1, fromM, v2, fromI = algn.insertSources(s, k)
+		}
 		if fromM && int(v1) > lenT {
 			fromM = false
 			v1 = 0
@@ -601,7 +737,10 @@ func (algn *Aligner) next(q, t *[]byte, s uint32) {
 			}
 
 			updatedI = true
-			I.Set(s, k, Isk, wfaTypeI)
+			if wfI == nil {
+				wfI = I.wavefront(s, k)
+			}
+			wfI.SetRaw(k, Isk<<wfaTypeBits|wfaTypeI)
 			// fmt.Printf("  %d fromM:%v(%d), fromI:%v(%d), save I: s=%d, k=%d, offset:%d, type:%s\n",
 			// 	Isk, fromM, v1, fromI, v2, s, k, Isk, wfaType2str(wfaTypeI))
 		} else {
@@ -611,8 +750,12 @@ func (algn *Aligner) next(q, t *[]byte, s uint32) {
 		// --------------------------------------
 		// deletion: 🠧
 
-		v1, _, fromM = M.GetAfterDiff(s, p.GapOpen+p.GapExt, k+1)
-		v2, _, fromD = D.GetAfterDiff(s, p.GapExt, k+1)
+		if fixedGaps {
+			v1, _, fromM = wfM0.Get(k + 1)
+			v2, _, fromD = wfD0.Get(k + 1)
+		} else {
+			v1, fromM, v2, fromD = algn.deleteSources(s, k)
+		}
 		if fromM && int(v1)-k > lenQ {
 			fromM = false
 			v1 = 0
@@ -637,7 +780,10 @@ func (algn *Aligner) next(q, t *[]byte, s uint32) {
 			}
 
 			updatedD = true
-			D.Set(s, k, Dsk, wfaTypeD)
+			if wfD == nil {
+				wfD = D.wavefront(s, k)
+			}
+			wfD.SetRaw(k, Dsk<<wfaTypeBits|wfaTypeD)
 			// fmt.Printf("  %d fromM:%v(%d), fromD:%v(%d), save D: s=%d, k=%d, offset:%d, type:%s\n",
 			// 	Dsk, fromM, v1, fromD, v2, s, k, Dsk, wfaType2str(wfaTypeD))
 		} else {
@@ -647,7 +793,11 @@ func (algn *Aligner) next(q, t *[]byte, s uint32) {
 		// --------------------------------------
 		// mismatch: ⬂
 
-		v1, _, fromM = M.GetAfterDiff(s, p.Mismatch, k)
+		if fixedMismatch {
+			v1, _, fromM = wfX0.Get(k)
+		} else {
+			v1, fromM = algn.mismatchSource(s, k)
+		}
 		if fromM && (int(v1) > lenT || int(v1)-k > lenQ) { // it's the last column/row
 			fromM = false
 			v1 = 0
@@ -692,7 +842,10 @@ func (algn *Aligner) next(q, t *[]byte, s uint32) {
 				wfaTypeM = wfaMismatch
 			}
 
-			M.Set(s, k, Msk, wfaTypeM)
+			if wfM == nil {
+				wfM = M.wavefront(s, k)
+			}
+			wfM.SetRaw(k, Msk<<wfaTypeBits|wfaTypeM)
 			// fmt.Printf("  %d fromI:%v(%d), fromD:%v(%d), fromM:%v(%d), save M: s=%d, k=%d, offset:%d, type:%s\n",
 			// 	Msk, updatedI, Isk, updatedD, Dsk, fromM, v1+1, s, k, Msk, wfaType2str(wfaTypeM))
 		}
@@ -700,15 +853,13 @@ func (algn *Aligner) next(q, t *[]byte, s uint32) {
 }
 
 // backTrace backtraces the alignment
-func (algn *Aligner) backTrace(q, t *[]byte, s uint32, Ak int) *AlignmentResult {
+func (algn *Aligner) backTrace(seqs sequences, s uint32, Ak int) *AlignmentResult {
 	semiGlobal := !algn.opt.GlobalAlignment
 	var M0 *Component
 	M := algn.M
 	I := algn.I
 	D := algn.D
-	p := algn.p
-	lenQ := len(*q)
-	lenT := len(*t)
+	lenQ, lenT := seqs.lens()
 
 	cigar := NewAlignmentResult(algn.opt.GlobalAlignment)
 	cigar.Score = s
@@ -723,7 +874,6 @@ func (algn *Aligner) backTrace(q, t *[]byte, s uint32, Ak int) *AlignmentResult
 	var v1, v2, Isk, Dsk, offset0 uint32
 	var fromMI, fromMD, fromItself bool
 	var fromI, fromD, fromM bool
-	var sMismatch, sGapOpen, sGapExt uint32
 	var previousFromM bool
 	var nMatches int
 
@@ -756,17 +906,11 @@ LOOP:
 		// -----------------------------------------------------------------------------
 		// compute the offset before extending
 
-		// score of source
-		sMismatch = s - p.Mismatch
-		sGapOpen = s - p.GapOpen - p.GapExt
-		sGapExt = s - p.GapExt
-
 		// offset of the source
 		fromMI, fromMD = false, false
 		switch wfaType {
 		case wfaInsertExt:
-			v1, _, fromM = M.Get(sGapOpen, k-1)
-			v2, _, fromI = I.Get(sGapExt, k-1)
+			v1, fromM, v2, fromI = algn.insertSources(s, k)
 			if fromM || fromI {
 				fromMI = true
 				offset0 = max(v1, v2) + 1
@@ -776,8 +920,7 @@ LOOP:
 
 			M0 = I // for get the wfaType of the next one
 		case wfaDeleteExt:
-			v1, _, fromM = M.Get(sGapOpen, k+1)
-			v2, _, fromD = D.Get(sGapExt, k+1)
+			v1, fromM, v2, fromD = algn.deleteSources(s, k)
 			if fromM || fromD {
 				fromMD = true
 				offset0 = max(v1, v2)
@@ -787,8 +930,7 @@ LOOP:
 
 			M0 = D
 		default:
-			v1, _, fromM = M.Get(sGapOpen, k-1)
-			v2, _, fromI = I.Get(sGapExt, k-1)
+			v1, fromM, v2, fromI = algn.insertSources(s, k)
 			if fromM || fromI {
 				fromMI = true
 				Isk = max(v1, v2) + 1
@@ -796,8 +938,7 @@ LOOP:
 				Isk = 0
 			}
 
-			v1, _, fromM = M.Get(sGapOpen, k+1)
-			v2, _, fromD = D.Get(sGapExt, k+1)
+			v1, fromM, v2, fromD = algn.deleteSources(s, k)
 			if fromM || fromD {
 				fromMD = true
 				Dsk = max(v1, v2)
@@ -805,7 +946,7 @@ LOOP:
 				Dsk = 0
 			}
 
-			v1, _, fromM = M.Get(sMismatch, k)
+			v1, fromM = algn.mismatchSource(s, k)
 			if fromMI || fromMD || fromM {
 				offset0 = max(Isk, Dsk, v1+1)
 				fromItself = false
@@ -885,22 +1026,22 @@ LOOP:
 		previousFromM = true
 		switch wfaType {
 		case wfaMismatch:
-			s = sMismatch
+			s -= algn.mismatchPenalty(v)
 			h--
 		case wfaInsertOpen:
-			s = sGapOpen
+			s -= algn.gapPenalty(wfaType, v, h)
 			k--
 			h--
 		case wfaInsertExt:
-			s = sGapExt
+			s -= algn.gapPenalty(wfaType, v, h)
 			k--
 			h--
 			previousFromM = false
 		case wfaDeleteOpen:
-			s = sGapOpen
+			s -= algn.gapPenalty(wfaType, v, h)
 			k++
 		case wfaDeleteExt:
-			s = sGapExt
+			s -= algn.gapPenalty(wfaType, v, h)
 			k++
 			previousFromM = false
 		default:
@@ -0,0 +1,71 @@
+// Copyright © 2024 Wei Shen <shenwei356@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package wfa
+
+// AlignerStats records how much work alignments did, which helps to tune heuristics.
+// Counters are accumulated over alignments, so reset it if needed.
+type AlignerStats struct {
+	Steps           int // score steps with wavefronts, i.e., calls of the observer
+	WaveFronts      int // wavefronts allocated in the M, I and D components
+	Cells           int // cells computed in next(), i.e., the k ranges of new wavefronts
+	BasesCompared   int // bases compared in extend()
+	PrunedDiagonals int // diagonals deleted in adaptive reduction
+	PeakMemory      int // the peak size of offsets in the M, I and D components, in bytes
+}
+
+// Reset clears all counters.
+func (stats *AlignerStats) Reset() {
+	*stats = AlignerStats{}
+}
+
+// CollectStats sets a stats collector, nil for disabling it.
+// Alignments with sequence graphs are not counted.
+func (algn *Aligner) CollectStats(stats *AlignerStats) {
+	algn.stats = stats
+}
+
+// Observe sets a function which is called after the extension (and reduction)
+// of each score step, with the score and the k range of the M wavefront.
+// nil for disabling it.
+func (algn *Aligner) Observe(observer func(s uint32, lo, hi int)) {
+	algn.observer = observer
+}
+
+// updateStats updates the stats after computing wavefronts.
+func (algn *Aligner) updateStats() {
+	stats := algn.stats
+
+	var mem int
+	for _, cpt := range []*Component{algn.M, algn.I, algn.D} {
+		stats.WaveFronts += cpt.nWF
+		mem += cpt.arena.size() << 2
+	}
+	stats.PeakMemory = max(stats.PeakMemory, mem)
+}
+
+// size returns the number of used values, including unused tails of filled chunks.
+func (a *arena) size() int {
+	var n int
+	for _, c := range a.chunks[:min(a.i, len(a.chunks))] {
+		n += len(c)
+	}
+	return n + a.j
+}
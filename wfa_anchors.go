@@ -0,0 +1,355 @@
+// Copyright © 2024 Wei Shen <shenwei356@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package wfa
+
+import (
+	"fmt"
+	"math"
+	"sort"
+)
+
+// Anchor is an exact match between the query and the target.
+type Anchor struct {
+	Q, T int // 0-based start positions in the query and target
+	Len  int // length of the match
+}
+
+// SeedOptions contains the parameters for finding anchors with minimizers.
+type SeedOptions struct {
+	K int // k-mer size, in the range of [1, 32]
+	W int // window size, i.e., the number of consecutive k-mers
+}
+
+// DefaultSeedOptions is the default seed options.
+var DefaultSeedOptions = &SeedOptions{
+	K: 19,
+	W: 10,
+}
+
+// ErrInvalidSeedOptions means the seed options are invalid.
+var ErrInvalidSeedOptions error = fmt.Errorf("wfa: invalid seed options, k should be in [1, 32] and w should be positive")
+
+// ErrInvalidAnchor means an anchor is not an exact match within the sequences.
+var ErrInvalidAnchor error = fmt.Errorf("wfa: invalid anchor")
+
+// FindAnchors finds anchors from minimizers which are unique in both the query and target.
+// Overlapping or adjacent hits on the same diagonal are merged into one anchor.
+// Only k-mers of uppercase A, C, G, T are used, as bases are compared case-sensitively in alignment.
+// Anchors are sorted by positions in the target.
+func FindAnchors(q, t []byte, opt *SeedOptions) ([]Anchor, error) {
+	if opt.K < 1 || opt.K > 32 || opt.W < 1 {
+		return nil, ErrInvalidSeedOptions
+	}
+
+	// minimizers of the target, -1 for duplicated ones
+	idx := make(map[uint64]int, len(t)/opt.W*2)
+	minimizers(t, opt.K, opt.W, func(pos int, code uint64) {
+		if _, ok := idx[code]; ok {
+			idx[code] = -1
+		} else {
+			idx[code] = pos
+		}
+	})
+
+	qIdx := make(map[uint64]int, len(q)/opt.W*2)
+	minimizers(q, opt.K, opt.W, func(pos int, code uint64) {
+		if _, ok := qIdx[code]; ok {
+			qIdx[code] = -1
+		} else {
+			qIdx[code] = pos
+		}
+	})
+
+	hits := make([]Anchor, 0, len(qIdx))
+	for code, v := range qIdx {
+		if v < 0 {
+			continue
+		}
+		if h, ok := idx[code]; ok && h >= 0 {
+			hits = append(hits, Anchor{Q: v, T: h, Len: opt.K})
+		}
+	}
+	if len(hits) == 0 {
+		return hits, nil
+	}
+
+	// merge hits on the same diagonal
+	sort.Slice(hits, func(i, j int) bool {
+		di, dj := hits[i].T-hits[i].Q, hits[j].T-hits[j].Q
+		if di == dj {
+			return hits[i].Q < hits[j].Q
+		}
+		return di < dj
+	})
+	var j int
+	var a, b *Anchor
+	for i := 1; i < len(hits); i++ {
+		a, b = &hits[j], &hits[i]
+		if a.T-a.Q == b.T-b.Q && a.Q+a.Len >= b.Q {
+			a.Len = max(a.Len, b.Q+b.Len-a.Q)
+			continue
+		}
+		j++
+		hits[j] = *b
+	}
+	hits = hits[:j+1]
+
+	sort.Slice(hits, func(i, j int) bool {
+		if hits[i].T == hits[j].T {
+			return hits[i].Q < hits[j].Q
+		}
+		return hits[i].T < hits[j].T
+	})
+	return hits, nil
+}
+
+// minimizers computes the (w, k)-minimizers of a sequence, and calls fn for each of them
+// with the 0-based position and the 2-bit code of the k-mer.
+func minimizers(s []byte, k, w int, fn func(pos int, code uint64)) {
+	nk := len(s) - k + 1
+	if nk <= 0 {
+		return
+	}
+	w = min(w, nk)
+
+	type kmer struct {
+		pos        int
+		code, hash uint64
+	}
+	ring := make([]kmer, w)
+	mask := uint64(1)<<(uint(k)<<1) - 1 // k == 32 is fine as 1<<64 is 0
+	var code uint64
+	var l int // length of the current run of valid bases
+	var m kmer
+	m.pos, m.hash = -1, math.MaxUint64
+	last := -1 // position of the last minimizer
+	var x kmer
+	var i int
+	for j, c := range s {
+		switch c {
+		case 'A':
+			code = code << 2 & mask
+		case 'C':
+			code = (code<<2 | 1) & mask
+		case 'G':
+			code = (code<<2 | 2) & mask
+		case 'T':
+			code = (code<<2 | 3) & mask
+		default:
+			l = -1
+		}
+		l++
+
+		i = j - k + 1 // start of the k-mer
+		if i < 0 {
+			continue
+		}
+		x.pos, x.code = i, code
+		if l >= k {
+			x.hash = hash64(code, mask)
+		} else {
+			x.hash = math.MaxUint64
+		}
+		ring[i%w] = x
+
+		if m.pos < i-w+1 { // the minimizer is out of the window
+			m.pos, m.hash = -1, math.MaxUint64
+			for _, y := range ring {
+				if y.pos >= i-w+1 && y.hash != math.MaxUint64 &&
+					(y.hash < m.hash || (y.hash == m.hash && y.pos < m.pos)) {
+					m = y
+				}
+			}
+		} else if x.hash < m.hash {
+			m = x
+		}
+
+		if i >= w-1 && m.pos >= 0 && m.pos != last {
+			fn(m.pos, m.code)
+			last = m.pos
+		}
+	}
+}
+
+// hash64 is an invertible integer hash function, from minimap2.
+func hash64(key, mask uint64) uint64 {
+	key = (^key + (key << 21)) & mask
+	key = key ^ key>>24
+	key = ((key + (key << 3)) + (key << 8)) & mask
+	key = key ^ key>>14
+	key = ((key + (key << 2)) + (key << 4)) & mask
+	key = key ^ key>>28
+	key = (key + (key << 31)) & mask
+	return key
+}
+
+// chainMaxLookback is the maximum number of previous anchors to check in chaining.
+const chainMaxLookback = 64
+
+// ChainAnchors returns the highest-scoring chain of anchors which are co-linear and
+// not overlapping. The score of a chain is the total length of anchors
+// minus the differences of diagonals between consecutive ones.
+func ChainAnchors(anchors []Anchor) []Anchor {
+	if len(anchors) == 0 {
+		return nil
+	}
+
+	as := make([]Anchor, len(anchors))
+	copy(as, anchors)
+	sort.Slice(as, func(i, j int) bool {
+		if as[i].T == as[j].T {
+			return as[i].Q < as[j].Q
+		}
+		return as[i].T < as[j].T
+	})
+
+	scores := make([]int, len(as))
+	prevs := make([]int, len(as))
+	best := 0
+	var a, b *Anchor
+	var s, gap int
+	for i := range as {
+		b = &as[i]
+		scores[i], prevs[i] = b.Len, -1
+		for j := i - 1; j >= 0 && j >= i-chainMaxLookback; j-- {
+			a = &as[j]
+			if a.Q+a.Len > b.Q || a.T+a.Len > b.T {
+				continue
+			}
+			gap = (b.T - a.T) - (b.Q - a.Q)
+			if gap < 0 {
+				gap = -gap
+			}
+			if s = scores[j] + b.Len - gap; s > scores[i] {
+				scores[i], prevs[i] = s, j
+			}
+		}
+		if scores[i] > scores[best] {
+			best = i
+		}
+	}
+
+	var n int
+	for i := best; i >= 0; i = prevs[i] {
+		n++
+	}
+	chain := make([]Anchor, n)
+	for i := best; i >= 0; i = prevs[i] {
+		n--
+		chain[n] = as[i]
+	}
+	return chain
+}
+
+// AlignWithAnchors performs global alignment of two long sequences with anchors.
+// Anchors are chained first, then regions between consecutive anchors are aligned
+// with the aligner, and all pieces are stitched into one alignment.
+// If anchors is nil, they are found with FindAnchors() and DefaultSeedOptions.
+//
+// Global alignment is always performed, no matter what Options.GlobalAlignment is.
+// The score is recomputed for the whole alignment, so it is consistent with
+// position-specific gap penalties, while it might not be optimal.
+func (algn *Aligner) AlignWithAnchors(q, t []byte, anchors []Anchor) (*AlignmentResult, error) {
+	if len(q) == 0 || len(t) == 0 {
+		return nil, ErrEmptySeq
+	}
+	var err error
+	if anchors == nil {
+		if anchors, err = FindAnchors(q, t, DefaultSeedOptions); err != nil {
+			return nil, err
+		}
+	}
+	anchors = ChainAnchors(anchors)
+	for _, a := range anchors {
+		if a.Len <= 0 || a.Q < 0 || a.T < 0 || a.Q+a.Len > len(q) || a.T+a.Len > len(t) {
+			return nil, ErrInvalidAnchor
+		}
+		for i := 0; i < a.Len; i++ {
+			if q[a.Q+i] != t[a.T+i] {
+				return nil, ErrInvalidAnchor
+			}
+		}
+	}
+
+	defer algn.setGlobalAlignment(true)()
+
+	cigar := NewAlignmentResult(true)
+	var v, h int // 0-based positions of the next bases
+	for i := 0; i <= len(anchors); i++ {
+		var a Anchor // a virtual anchor at the end
+		if i < len(anchors) {
+			a = anchors[i]
+		} else {
+			a = Anchor{Q: len(q), T: len(t)}
+		}
+
+		if err = algn.alignPiece(cigar, q[v:a.Q], t[h:a.T]); err != nil {
+			RecycleAlignmentResult(cigar)
+			return nil, err
+		}
+		cigar.appendOps(OpM<<32 | uint64(a.Len))
+		v, h = a.Q+a.Len, a.T+a.Len
+	}
+	algn.finishPieces(cigar, q, t)
+
+	return cigar, nil
+}
+
+// setGlobalAlignment makes the aligner perform global or semi-global alignment,
+// and returns a function to restore the options.
+func (algn *Aligner) setGlobalAlignment(global bool) func() {
+	opt0 := algn.opt
+	opt := *algn.opt
+	opt.GlobalAlignment = global
+	algn.opt = &opt
+	return func() { algn.opt = opt0 }
+}
+
+// alignPiece aligns a region between two anchors and appends the operations.
+func (algn *Aligner) alignPiece(cigar *AlignmentResult, q, t []byte) error {
+	if len(q) == 0 {
+		cigar.appendOps(OpI<<32 | uint64(len(t)))
+		return nil
+	}
+	if len(t) == 0 {
+		cigar.appendOps(OpD<<32 | uint64(len(q)))
+		return nil
+	}
+
+	piece, err := algn.align(algn.bytes(&q, &t))
+	if err != nil {
+		return err
+	}
+	cigar.appendOps(piece.Ops...)
+	RecycleAlignmentResult(piece)
+	return nil
+}
+
+// finishPieces computes the stats, locations and score of stitched pieces.
+// The score is recomputed for the whole alignment, so a gap spanning a boundary of
+// two pieces is only penalized with one gap opening.
+func (algn *Aligner) finishPieces(cigar *AlignmentResult, q, t []byte) {
+	cigar.proccessed = true
+	cigar.count()
+	cigar.locate()
+
+	cigar.Score = algn.rescoreSeqs(nil, algn.bytes(&q, &t), cigar)
+}
@@ -36,15 +36,26 @@ type AlignmentResult struct {
 	TBegin, TEnd int // 1-based location of the alignment in target seq, no including flanking clipping/insertion sequences
 	QBegin, QEnd int // 1-based location of the alignment in query seq, no including flanking clipping/insertion sequences
 
+	// For circular alignment, the query is rotated by Rotation bases,
+	// i.e., q[Rotation:] + q[:Rotation] is aligned, and query coordinates are of the rotated one.
+	Rotation int
+
 	// Stats of the aligned region, no including flanking clipping/insertion sequences
 	AlignLen   uint32
 	Matches    uint32
 	Gaps       uint32
 	GapRegions uint32
 
+	Stats AlignmentStats // More stats of the aligned region
+
 	proccessed bool
 
 	globalAlignment bool
+
+	// cumulative index of operations for mapping positions
+	indexed        bool
+	qEnds, tEnds   []int // numbers of query/target bases consumed after each operation
+	opBegin, opEnd int   // indexes of operations in the aligned region
 }
 
 // // CIGARRecord records the operation and the number.
@@ -80,7 +91,9 @@ func (cigar *AlignmentResult) reset() {
 	// }
 	cigar.Ops = cigar.Ops[:0]
 	cigar.Score = 0
+	cigar.Rotation = 0
 	cigar.proccessed = false
+	cigar.indexed = false
 
 	cigar.AlignLen = 0
 	cigar.Matches = 0
@@ -168,6 +181,17 @@ func (cigar *AlignmentResult) process() {
 	}
 	*s = (*s)[:j+1]
 
+	cigar.count()
+
+	cigar.proccessed = true
+}
+
+// count computes the stats of the aligned region.
+func (cigar *AlignmentResult) count() {
+	s := &cigar.Ops
+	var i int
+	var op uint64
+
 	// count matches, gaps
 	var begin, end int
 	for i, op = range *s {
@@ -189,20 +213,36 @@ func (cigar *AlignmentResult) process() {
 	var matches uint32
 	var gaps uint32
 	var gapRegions uint32
+	var n uint32
+
+	stats := &cigar.Stats
+	stats.reset()
 
 	for i = begin; i <= end; i++ {
 		op = (*s)[i]
 		// alen += op.N
-		alen += uint32(op & MaskLower32)
+		n = uint32(op & MaskLower32)
+		alen += n
 		// switch op.Op {
 		switch op >> 32 {
 		// case 'M':
 		case OpM:
-			matches += uint32(op & MaskLower32)
+			matches += n
+		case OpX:
+			stats.Mismatches += n
 		// case 'I', 'D':
 		case OpI, OpD:
-			gaps += uint32(op & MaskLower32)
+			gaps += n
 			gapRegions++
+
+			if op>>32 == OpI {
+				stats.InsertedBases += n
+				stats.Insertions++
+			} else {
+				stats.DeletedBases += n
+				stats.Deletions++
+			}
+			stats.addGap(n)
 		}
 	}
 	cigar.AlignLen = alen
@@ -210,7 +250,52 @@ func (cigar *AlignmentResult) process() {
 	cigar.Gaps = gaps
 	cigar.GapRegions = gapRegions
 
-	cigar.proccessed = true
+	stats.AlignLen = alen
+	stats.Matches = matches
+
+	cigar.indexed = false // operations might be changed
+}
+
+// appendOps appends operations to a processed CIGAR, the first one is merged
+// with the last existing one if they are of the same type.
+func (cigar *AlignmentResult) appendOps(ops ...uint64) {
+	for _, op := range ops {
+		if op&MaskLower32 == 0 {
+			continue
+		}
+		l := len(cigar.Ops)
+		if l > 0 && cigar.Ops[l-1]>>32 == op>>32 {
+			cigar.Ops[l-1] += op & MaskLower32
+			continue
+		}
+		cigar.Ops = append(cigar.Ops, op)
+	}
+}
+
+// locate computes the locations of the aligned region, i.e., from the first match to the last one,
+// from processed operations.
+func (cigar *AlignmentResult) locate() {
+	cigar.QBegin, cigar.QEnd, cigar.TBegin, cigar.TEnd = 0, 0, 0, 0
+	var v, h, n int // numbers of consumed bases
+	for _, op := range cigar.Ops {
+		n = int(op & MaskLower32)
+		switch op >> 32 {
+		case OpM:
+			if cigar.QBegin == 0 {
+				cigar.QBegin, cigar.TBegin = v+1, h+1
+			}
+			v += n
+			h += n
+			cigar.QEnd, cigar.TEnd = v, h
+		case OpX:
+			v += n
+			h += n
+		case OpI:
+			h += n
+		case OpD, OpH:
+			v += n
+		}
+	}
 }
 
 // trimOps trim ops to keep only aligned region
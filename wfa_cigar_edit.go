@@ -0,0 +1,207 @@
+// Copyright © 2024 Wei Shen <shenwei356@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package wfa
+
+import "fmt"
+
+// ErrInvalidInterval means the interval is out of range.
+var ErrInvalidInterval error = fmt.Errorf("wfa: invalid interval")
+
+// Append appends another alignment, e.g., of the following pieces of the sequences.
+// Adjacent operations of the same type are merged, and if a gap spans the join,
+// the score is reduced by one gap opening penalty in p.
+// It is designed for global alignments, flanking gaps of semi-global alignments
+// are kept as they are.
+func (cigar *AlignmentResult) Append(b *AlignmentResult, p *Penalties) {
+	if len(cigar.Ops) == 0 {
+		cigar.proccessed = true
+	}
+	if len(b.Ops) == 0 {
+		return
+	}
+	cigar.process()
+	b.process()
+
+	score := cigar.Score + b.Score
+	if l := len(cigar.Ops); l > 0 {
+		op := cigar.Ops[l-1] >> 32
+		if (op == OpI || op == OpD) && op == b.Ops[0]>>32 {
+			score -= p.GapOpen
+		}
+	}
+	cigar.Score = score
+
+	cigar.appendOps(b.Ops...)
+	cigar.globalAlignment = cigar.globalAlignment && b.globalAlignment
+	cigar.count()
+	cigar.locate()
+}
+
+// SliceQuery returns the alignment of a 1-based query interval [start, end],
+// and the 1-based target interval aligned to it, which is 0, 0 if the query bases
+// are all aligned to gaps. Gaps at the two ends of the interval are not included.
+// The score is computed with p. Do not forget to recycle the result.
+func (cigar *AlignmentResult) SliceQuery(start, end int, p *Penalties) (*AlignmentResult, int, int, error) {
+	return cigar.slice(start, end, true, p)
+}
+
+// SliceTarget returns the alignment of a 1-based target interval [start, end],
+// and the 1-based query interval aligned to it. The rules are the same as SliceQuery.
+func (cigar *AlignmentResult) SliceTarget(start, end int, p *Penalties) (*AlignmentResult, int, int, error) {
+	return cigar.slice(start, end, false, p)
+}
+
+// slice returns the alignment of an interval of the query or target.
+func (cigar *AlignmentResult) slice(start, end int, onQuery bool, p *Penalties) (*AlignmentResult, int, int, error) {
+	cigar.process()
+
+	var pos, other int // numbers of consumed bases of the sliced sequence and the other one
+	var n, lo, hi int
+	var self, both bool // the operation consumes bases of the sliced sequence, and both sequences
+	var oBegin, oEnd int
+	result := NewAlignmentResult(cigar.globalAlignment)
+	for _, op := range cigar.Ops {
+		n = int(op & MaskLower32)
+		switch op >> 32 {
+		case OpM, OpX:
+			self, both = true, true
+		case OpI:
+			self, both = !onQuery, false
+		default: // D, H
+			self, both = onQuery, false
+		}
+
+		if !self { // a gap in the sliced sequence
+			if pos >= start && pos < end {
+				result.appendOps(op)
+				if oBegin == 0 {
+					oBegin = other + 1
+				}
+				oEnd = other + n
+			}
+			other += n
+			continue
+		}
+
+		lo, hi = max(pos+1, start), min(pos+n, end)
+		if lo <= hi {
+			result.appendOps(op>>32<<32 | uint64(hi-lo+1))
+			if both {
+				if oBegin == 0 {
+					oBegin = other + lo - pos
+				}
+				oEnd = other + hi - pos
+			}
+		}
+		pos += n
+		if both {
+			other += n
+		}
+	}
+
+	if start < 1 || end < start || end > pos {
+		RecycleAlignmentResult(result)
+		return nil, 0, 0, ErrInvalidInterval
+	}
+
+	result.proccessed = true
+	result.count()
+	result.locate()
+	result.Score = result.score(p)
+	return result, oBegin, oEnd, nil
+}
+
+// score computes the alignment score with position-independent penalties.
+// For semi-global alignment, flanking insertions (I) and clippings (H) are free.
+func (cigar *AlignmentResult) score(p *Penalties) uint32 {
+	ops := cigar.Ops
+	begin, end := 0, len(ops)-1
+	if !cigar.globalAlignment {
+		for begin < len(ops) && !isMatchOrMismatch(ops[begin]) {
+			begin++
+		}
+		for end >= 0 && !isMatchOrMismatch(ops[end]) {
+			end--
+		}
+	}
+
+	var score, n uint32
+	for i, op := range ops {
+		n = uint32(op & MaskLower32)
+		switch op >> 32 {
+		case OpX:
+			score += p.Mismatch * n
+		case OpI:
+			if i >= begin && i <= end {
+				score += p.GapOpen + p.GapExt*n
+			}
+		case OpD:
+			score += p.GapOpen + p.GapExt*n
+		}
+	}
+	return score
+}
+
+// Reverse reverses the order of operations, e.g., for an alignment of reversed sequences.
+func (cigar *AlignmentResult) Reverse() {
+	cigar.process()
+	ops := cigar.Ops
+	for i, j := 0, len(ops)-1; i < j; i, j = i+1, j-1 {
+		ops[i], ops[j] = ops[j], ops[i]
+	}
+	cigar.count()
+	cigar.locate()
+}
+
+// Invert swaps the roles of the query and target, i.e., I and D are swapped.
+// For semi-global alignment, flanking insertions (I) and clippings (H) are swapped.
+func (cigar *AlignmentResult) Invert() {
+	cigar.process()
+	ops := cigar.Ops
+	begin, end := 0, len(ops)-1
+	if !cigar.globalAlignment {
+		for begin < len(ops) && !isMatchOrMismatch(ops[begin]) {
+			begin++
+		}
+		for end >= 0 && !isMatchOrMismatch(ops[end]) {
+			end--
+		}
+	}
+
+	var n uint64
+	for i, op := range ops {
+		n = op & MaskLower32
+		switch op >> 32 {
+		case OpI:
+			if i >= begin && i <= end {
+				ops[i] = OpD<<32 | n
+			} else {
+				ops[i] = OpH<<32 | n
+			}
+		case OpD:
+			ops[i] = OpI<<32 | n
+		case OpH:
+			ops[i] = OpI<<32 | n
+		}
+	}
+	cigar.count()
+	cigar.locate()
+}
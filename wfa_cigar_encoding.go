@@ -0,0 +1,221 @@
+// Copyright © 2024 Wei Shen <shenwei356@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package wfa
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"strconv"
+)
+
+// ErrInvalidCIGAR means the CIGAR string is invalid.
+var ErrInvalidCIGAR error = fmt.Errorf("wfa: invalid CIGAR")
+
+// ErrInvalidBinaryAlignment means the binary data of an alignment result is invalid.
+var ErrInvalidBinaryAlignment error = fmt.Errorf("wfa: invalid binary data of alignment result")
+
+// the version of the binary format.
+const binaryAlignmentVersion = 1
+
+// alignmentResultJSON is the JSON form of AlignmentResult.
+type alignmentResultJSON struct {
+	CIGAR  string `json:"cigar"`
+	Score  uint32 `json:"score"`
+	Global bool   `json:"global"`
+
+	QBegin int `json:"qbegin"`
+	QEnd   int `json:"qend"`
+	TBegin int `json:"tbegin"`
+	TEnd   int `json:"tend"`
+
+	Rotation int `json:"rotation,omitempty"`
+
+	// stats are recomputed from the CIGAR in unmarshaling.
+	AlignLen   uint32          `json:"align_len"`
+	Matches    uint32          `json:"matches"`
+	Gaps       uint32          `json:"gaps"`
+	GapRegions uint32          `json:"gap_regions"`
+	Stats      *AlignmentStats `json:"stats"`
+}
+
+// MarshalJSON implements the json.Marshaler interface.
+func (cigar *AlignmentResult) MarshalJSON() ([]byte, error) {
+	return json.Marshal(&alignmentResultJSON{
+		CIGAR:  cigar.CIGAR(false),
+		Score:  cigar.Score,
+		Global: cigar.globalAlignment,
+
+		QBegin: cigar.QBegin,
+		QEnd:   cigar.QEnd,
+		TBegin: cigar.TBegin,
+		TEnd:   cigar.TEnd,
+
+		Rotation: cigar.Rotation,
+
+		AlignLen:   cigar.AlignLen,
+		Matches:    cigar.Matches,
+		Gaps:       cigar.Gaps,
+		GapRegions: cigar.GapRegions,
+		Stats:      &cigar.Stats,
+	})
+}
+
+// UnmarshalJSON implements the json.Unmarshaler interface.
+func (cigar *AlignmentResult) UnmarshalJSON(data []byte) error {
+	var r alignmentResultJSON
+	if err := json.Unmarshal(data, &r); err != nil {
+		return err
+	}
+
+	cigar.reset()
+	if err := cigar.parseCIGAR(r.CIGAR); err != nil {
+		return err
+	}
+	cigar.Score = r.Score
+	cigar.globalAlignment = r.Global
+	cigar.QBegin, cigar.QEnd = r.QBegin, r.QEnd
+	cigar.TBegin, cigar.TEnd = r.TBegin, r.TEnd
+	cigar.Rotation = r.Rotation
+
+	cigar.count()
+	cigar.proccessed = true
+	return nil
+}
+
+// parseCIGAR parses a CIGAR string into operations.
+func (cigar *AlignmentResult) parseCIGAR(s string) error {
+	var j int
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case 'M', 'X', 'I', 'D', 'H':
+			n, err := strconv.ParseUint(s[j:i], 10, 32)
+			if err != nil || n == 0 {
+				return ErrInvalidCIGAR
+			}
+			cigar.AddN(s[i], uint32(n))
+			j = i + 1
+		default:
+			if s[i] < '0' || s[i] > '9' {
+				return ErrInvalidCIGAR
+			}
+		}
+	}
+	if j != len(s) || len(cigar.Ops) == 0 {
+		return ErrInvalidCIGAR
+	}
+	return nil
+}
+
+// MarshalBinary implements the encoding.BinaryMarshaler interface.
+// The compact form contains a version byte, a flag byte,
+// varints of the score, coordinates and the rotation (only for circular alignment), and the operations.
+// Stats are not stored but recomputed in unmarshaling.
+func (cigar *AlignmentResult) MarshalBinary() ([]byte, error) {
+	cigar.process()
+
+	data := make([]byte, 0, 16+len(cigar.Ops)*3)
+	data = append(data, binaryAlignmentVersion)
+	var flag byte
+	if cigar.globalAlignment {
+		flag |= 1
+	}
+	if cigar.Rotation > 0 {
+		flag |= 2
+	}
+	data = append(data, flag)
+
+	data = binary.AppendUvarint(data, uint64(cigar.Score))
+	data = binary.AppendUvarint(data, uint64(cigar.QBegin))
+	data = binary.AppendUvarint(data, uint64(cigar.QEnd))
+	data = binary.AppendUvarint(data, uint64(cigar.TBegin))
+	data = binary.AppendUvarint(data, uint64(cigar.TEnd))
+	if cigar.Rotation > 0 {
+		data = binary.AppendUvarint(data, uint64(cigar.Rotation))
+	}
+
+	data = binary.AppendUvarint(data, uint64(len(cigar.Ops)))
+	for _, op := range cigar.Ops {
+		data = append(data, byte(op>>32))
+		data = binary.AppendUvarint(data, op&MaskLower32)
+	}
+	return data, nil
+}
+
+// UnmarshalBinary implements the encoding.BinaryUnmarshaler interface.
+func (cigar *AlignmentResult) UnmarshalBinary(data []byte) error {
+	if len(data) < 2 || data[0] != binaryAlignmentVersion {
+		return ErrInvalidBinaryAlignment
+	}
+	global := data[1]&1 > 0
+	rotated := data[1]&2 > 0
+	data = data[2:]
+
+	var values [7]uint64 // score, 4 coordinates, (rotation), number of operations
+	var n int
+	for i := range values {
+		if i == 5 && !rotated {
+			continue
+		}
+		values[i], n = binary.Uvarint(data)
+		if n <= 0 {
+			return ErrInvalidBinaryAlignment
+		}
+		data = data[n:]
+	}
+	if values[0] > MaskLower32 || values[6] == 0 {
+		return ErrInvalidBinaryAlignment
+	}
+
+	cigar.reset()
+	cigar.Score = uint32(values[0])
+	cigar.QBegin, cigar.QEnd = int(values[1]), int(values[2])
+	cigar.TBegin, cigar.TEnd = int(values[3]), int(values[4])
+	cigar.Rotation = int(values[5])
+	cigar.globalAlignment = global
+
+	var op byte
+	var c uint64
+	for i := uint64(0); i < values[6]; i++ {
+		if len(data) < 2 {
+			return ErrInvalidBinaryAlignment
+		}
+		op = data[0]
+		switch op {
+		case 'M', 'X', 'I', 'D', 'H':
+		default:
+			return ErrInvalidBinaryAlignment
+		}
+		c, n = binary.Uvarint(data[1:])
+		if n <= 0 || c > MaskLower32 {
+			return ErrInvalidBinaryAlignment
+		}
+		cigar.AddN(op, uint32(c))
+		data = data[1+n:]
+	}
+	if len(data) > 0 {
+		return ErrInvalidBinaryAlignment
+	}
+
+	cigar.count()
+	cigar.proccessed = true
+	return nil
+}
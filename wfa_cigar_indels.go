@@ -0,0 +1,246 @@
+// Copyright © 2024 Wei Shen <shenwei356@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package wfa
+
+import "sync"
+
+// IndelAlignment decides where to place an indel which has several equivalent positions,
+// e.g., in a repeat.
+type IndelAlignment uint8
+
+const (
+	IndelAsIs         IndelAlignment = iota // as it is returned by backtrace
+	IndelLeftAligned                        // the leftmost position, the VCF convention
+	IndelRightAligned                       // the rightmost position
+)
+
+// LeftAlignIndels moves all indels in the aligned region to their leftmost equivalent positions,
+// i.e., the VCF convention. q and t are the query and target sequences used in the alignment.
+//
+// An indel is only moved across matched bases, and at least one matched base is kept
+// before it, so the alignment score does not change with position-independent penalties.
+// For position-specific penalties, use Options.IndelAlignment instead.
+func (cigar *AlignmentResult) LeftAlignIndels(q, t *[]byte) {
+	cigar.normalizeIndels(bytesMatcher(q, t), true, nil)
+}
+
+// RightAlignIndels moves all indels in the aligned region to their rightmost equivalent positions.
+// q and t are the query and target sequences used in the alignment.
+func (cigar *AlignmentResult) RightAlignIndels(q, t *[]byte) {
+	cigar.normalizeIndels(bytesMatcher(q, t), false, nil)
+}
+
+// bytesMatcher returns a function to check whether two bases with 0-based positions are identical.
+func bytesMatcher(q, t *[]byte) func(v, h int) bool {
+	return func(v, h int) bool { return (*q)[v] == (*t)[h] }
+}
+
+// normalizeIndels moves indels to the leftmost or rightmost equivalent positions.
+// eq checks whether two bases with 0-based positions are identical.
+// If gapPenalty is not nil, an indel is only moved when its penalty is not changed.
+func (cigar *AlignmentResult) normalizeIndels(eq func(v, h int) bool, left bool,
+	gapPenalty func(wfaType uint32, v, h int) uint32) {
+
+	cigar.process()
+
+	// expand operations into columns
+	cols := poolBytes.Get().(*[]byte)
+	*cols = (*cols)[:0]
+	var n, i uint32
+	for _, op := range cigar.Ops {
+		n = uint32(op & MaskLower32)
+		for i = 0; i < n; i++ {
+			*cols = append(*cols, byte(op>>32))
+		}
+	}
+	c := *cols
+
+	// the aligned region
+	first, last := -1, -1
+	for j, op := range c {
+		if op == 'M' {
+			if first < 0 {
+				first = j
+			}
+			last = j
+		}
+	}
+	if first < 0 {
+		*cols = (*cols)[:0]
+		poolBytes.Put(cols)
+		return
+	}
+
+	// 0-based positions of the bases of each column, or the next bases for gaps.
+	vs := poolInts.Get().(*[]int)
+	hs := poolInts.Get().(*[]int)
+	*vs, *hs = (*vs)[:0], (*hs)[:0]
+	var v, h int
+	for _, op := range c {
+		*vs = append(*vs, v)
+		*hs = append(*hs, h)
+		switch op {
+		case 'M', 'X':
+			v++
+			h++
+		case 'I':
+			h++
+		case 'D', 'H':
+			v++
+		}
+	}
+	V, H := *vs, *hs
+
+	// penalty of a gap run of length L, of which the first base is at 0-based positions v and h.
+	runPenalty := func(op byte, v, h, L int) uint32 {
+		var x uint32
+		if op == 'I' {
+			x = gapPenalty(wfaInsertOpen, v, h+1)
+			for j := 1; j < L; j++ {
+				x += gapPenalty(wfaInsertExt, v, h+j+1)
+			}
+		} else {
+			x = gapPenalty(wfaDeleteOpen, v+1, h)
+			for j := 1; j < L; j++ {
+				x += gapPenalty(wfaDeleteExt, v+j+1, h)
+			}
+		}
+		return x
+	}
+
+	// recompute positions of columns c[from:to+1]
+	update := func(from, to int) {
+		v, h := V[from], H[from]
+		for j := from; j <= to; j++ {
+			V[j], H[j] = v, h
+			switch c[j] {
+			case 'M', 'X':
+				v++
+				h++
+			case 'I':
+				h++
+			case 'D':
+				v++
+			}
+		}
+	}
+
+	var a, b, j, next, L int
+	var op byte
+	var x, y int
+	var ok bool
+	if left {
+		for j = first + 1; j < last; j = next {
+			op = c[j]
+			if op != 'I' && op != 'D' {
+				next = j + 1
+				continue
+			}
+			for a, b = j, j; b < last && c[b] == op; b++ {
+			}
+			next = b
+			L = b - a // the gap is c[a:b]
+
+			// the column before the gap should be a match which is not the first one,
+			// and the column before the match can not be the same gap to avoid merging two gaps.
+			for a-1 > first && c[a-1] == 'M' && c[a-2] != op {
+				x, y = V[a-1], H[a-1] // positions of the match
+				if op == 'D' {
+					ok = eq(x+L, y)
+				} else {
+					ok = eq(x, y+L)
+				}
+				if ok && gapPenalty != nil {
+					if op == 'D' {
+						ok = runPenalty(op, x+1, y, L) == runPenalty(op, x, y, L)
+					} else {
+						ok = runPenalty(op, x, y+1, L) == runPenalty(op, x, y, L)
+					}
+				}
+				if !ok {
+					break
+				}
+
+				c[a-1], c[b-1] = op, 'M'
+				update(a-1, b-1)
+				a--
+				b--
+			}
+		}
+	} else {
+		for j = last - 1; j > first; j = next {
+			op = c[j]
+			if op != 'I' && op != 'D' {
+				next = j - 1
+				continue
+			}
+			for a, b = j, j; a > first && c[a] == op; a-- {
+			}
+			a++
+			next = a - 1
+			L = b - a + 1 // the gap is c[a:b+1]
+
+			for b+1 < last && c[b+1] == 'M' && c[b+2] != op {
+				x, y = V[a], H[a] // positions of the first base of the gap
+				ok = eq(x, y)
+				if ok && gapPenalty != nil {
+					if op == 'D' {
+						ok = runPenalty(op, x, y, L) == runPenalty(op, x+1, y, L)
+					} else {
+						ok = runPenalty(op, x, y, L) == runPenalty(op, x, y+1, L)
+					}
+				}
+				if !ok {
+					break
+				}
+
+				c[a], c[b+1] = 'M', op
+				update(a, b+1)
+				a++
+				b++
+			}
+		}
+	}
+
+	// compress columns into operations
+	cigar.Ops = cigar.Ops[:0]
+	var pre byte
+	for j, op = range c {
+		if j > 0 && op == pre {
+			cigar.Ops[len(cigar.Ops)-1]++
+			continue
+		}
+		cigar.AddN(op, 1)
+		pre = op
+	}
+	cigar.count()
+
+	*cols = (*cols)[:0]
+	poolBytes.Put(cols)
+	*vs, *hs = (*vs)[:0], (*hs)[:0]
+	poolInts.Put(vs)
+	poolInts.Put(hs)
+}
+
+var poolInts = &sync.Pool{New: func() interface{} {
+	tmp := make([]int, 0, 1024)
+	return &tmp
+}}
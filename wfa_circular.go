@@ -0,0 +1,117 @@
+// Copyright © 2024 Wei Shen <shenwei356@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package wfa
+
+// AlignCircular aligns two circular sequences, e.g., plasmids or mitochondrial genomes,
+// which might start at different positions. It finds the best rotation of the query
+// relative to the target, and returns a global alignment of the rotated query and the target,
+// with the rotation stored in AlignmentResult.Rotation.
+//
+// The rotation is estimated from the diagonals of anchors found with FindAnchors(),
+// and then refined with a semi-global alignment of the beginning of the target against
+// a window of the doubled query around the estimated rotation.
+//
+// Query coordinates of the result are of the rotated query, RotateSeq(q, result.Rotation),
+// which should also be used in other methods like AlignmentText().
+// Use CircularQueryRegion() to get the aligned region in the original query.
+func (algn *Aligner) AlignCircular(q, t []byte) (*AlignmentResult, error) {
+	if len(q) == 0 || len(t) == 0 {
+		return nil, ErrEmptySeq
+	}
+	n := len(q)
+
+	// estimate the rotation with diagonals of anchors
+	anchors, err := FindAnchors(q, t, DefaultSeedOptions)
+	if err != nil {
+		return nil, err
+	}
+	votes := make(map[int]int, len(anchors))
+	var r0, d int
+	for _, a := range anchors {
+		d = ((a.Q-a.T)%n + n) % n
+		votes[d] += a.Len
+		if votes[d] > votes[r0] || (votes[d] == votes[r0] && d < r0) {
+			r0 = d
+		}
+	}
+
+	// refine it by aligning the beginning of the target against a window of the doubled query
+	// around the estimated position. Without anchors, the whole target and doubled query are used.
+	margin, L := n/2, len(t)
+	if len(anchors) > 0 {
+		margin, L = min(margin, circularMargin), min(L, circularRefineLen)
+	}
+	w := make([]byte, 0, n+margin*2)
+	for i := r0 - margin; i < r0+min(n, L)+margin; i++ {
+		w = append(w, q[((i%n)+n)%n])
+	}
+	t0 := t[:L]
+
+	// adaptive reduction might drop the best diagonal in semi-global alignment
+	restore := algn.setGlobalAlignment(false)
+	ad := algn.ad
+	algn.ad = nil
+	result, err := algn.align(algn.bytes(&t0, &w))
+	algn.ad = ad
+	restore()
+	if err != nil {
+		return nil, err
+	}
+	// position in the window aligned to the first base of the target
+	pos := result.TBegin - result.QBegin
+	RecycleAlignmentResult(result)
+	rotation := ((r0-margin+pos)%n + n) % n
+
+	// the final alignment is always global, adaptive reduction of the aligner still applies.
+	qr := RotateSeq(q, rotation)
+	restore = algn.setGlobalAlignment(true)
+	result, err = algn.align(algn.bytes(&qr, &t))
+	restore()
+	if err != nil {
+		return nil, err
+	}
+	result.Rotation = rotation
+	return result, nil
+}
+
+// circularMargin is the number of bases on both sides of the estimated rotation to refine.
+const circularMargin = 200
+
+// circularRefineLen is the length of the beginning of the target used to refine the rotation.
+const circularRefineLen = 1000
+
+// RotateSeq returns a new sequence rotated by r bases, i.e., s[r:] + s[:r].
+func RotateSeq(s []byte, r int) []byte {
+	if len(s) == 0 {
+		return []byte{}
+	}
+	r = ((r % len(s)) + len(s)) % len(s)
+	s2 := make([]byte, 0, len(s))
+	s2 = append(s2, s[r:]...)
+	return append(s2, s[:r]...)
+}
+
+// CircularQueryRegion returns the 1-based location of the aligned region in the original query
+// of a circular alignment, where end is smaller than begin if the region wraps around the origin.
+// lenQ is the length of the query.
+func (cigar *AlignmentResult) CircularQueryRegion(lenQ int) (int, int) {
+	return (cigar.QBegin-1+cigar.Rotation)%lenQ + 1, (cigar.QEnd-1+cigar.Rotation)%lenQ + 1
+}
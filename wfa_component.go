@@ -23,21 +23,29 @@ package wfa
 import (
 	"fmt"
 	"io"
+	"math"
 	"sync"
 )
 
 // WAVEFRONTS_BASE_SIZE is the base size of the wavefront slice.
 var WAVEFRONTS_BASE_SIZE = 2048
 
-var _WAVEFRONTS_GROW_SLICE = make([]*WaveFront, WAVEFRONTS_BASE_SIZE)
-
 // Component is the wavefront component, it's a list of wavefronts for different scores.
 // To support fast access, we use a list to them,
 // the nil data means there's no such wavefront for a given score.
+// Wavefronts and their offsets are stored in blocks and an arena, which are reused after Reset().
 type Component struct {
 	IsM bool // if it is true, the visualization is slightly different
 
 	WaveFronts []*WaveFront // WaveFronts
+
+	blocks [][]WaveFront // storage of wavefronts, blocks are never moved
+	nWF    int           // the number of used wavefronts in blocks
+	arena  arena
+	nS     int // the number of scores which might have wavefronts
+
+	// the k range of new wavefronts, so their windows are allocated only once.
+	hintLo, hintHi int
 }
 
 // NewComponent returns a new Component object.
@@ -48,19 +56,16 @@ func NewComponent() *Component {
 
 	cpt.Reset()
 
-	cpt.WaveFronts = cpt.WaveFronts[:WAVEFRONTS_BASE_SIZE]
-
 	return cpt
 }
 
 // Reset clears all existing wavefronts for new using.
 func (cpt *Component) Reset() {
-	for i, wf := range cpt.WaveFronts {
-		if wf != nil {
-			poolWaveFront.Put(wf)
-			cpt.WaveFronts[i] = nil // reset it to nil
-		}
-	}
+	clear(cpt.WaveFronts[:cpt.nS])
+	cpt.nS = 0
+	cpt.nWF = 0
+	cpt.arena.reset()
+	cpt.hintLo, cpt.hintHi = 0, 0
 }
 
 var poolComponent = &sync.Pool{New: func() interface{} {
@@ -77,6 +82,11 @@ func RecycleComponent(cpt *Component) {
 	}
 }
 
+// setKRangeHint sets the k range of following new wavefronts.
+func (cpt *Component) setKRangeHint(lo, hi int) {
+	cpt.hintLo, cpt.hintHi = lo, hi
+}
+
 // HasScore tells if a score exists.
 func (cpt *Component) HasScore(s uint32) bool {
 	if s >= uint32(len(cpt.WaveFronts)) {
@@ -100,42 +110,95 @@ func (cpt *Component) KRange(s, diff uint32) (int, int) {
 	return wf.Lo, wf.Hi
 }
 
-// Set sets an offset with a given backtrace type for a score.
-func (cpt *Component) Set(s uint32, k int, offset uint32, wfaType uint32) {
+// reserve makes sure the wavefront slice is long enough for a score.
+func (cpt *Component) reserve(s uint32) {
 	if s >= uint32(len(cpt.WaveFronts)) {
-		cpt.WaveFronts = append(cpt.WaveFronts, _WAVEFRONTS_GROW_SLICE...)
+		n := (int(s) - len(cpt.WaveFronts) + WAVEFRONTS_BASE_SIZE) / WAVEFRONTS_BASE_SIZE * WAVEFRONTS_BASE_SIZE
+		cpt.WaveFronts = append(cpt.WaveFronts, make([]*WaveFront, n)...)
 	}
-	wf := cpt.WaveFronts[s]
-	if wf == nil {
-		wf = NewWaveFront()
-		cpt.WaveFronts[s] = wf
+}
+
+// newWaveFront returns an unused wavefront from the blocks.
+func (cpt *Component) newWaveFront() *WaveFront {
+	i, j := cpt.nWF/WAVEFRONTS_BASE_SIZE, cpt.nWF%WAVEFRONTS_BASE_SIZE
+	if i == len(cpt.blocks) {
+		cpt.blocks = append(cpt.blocks, make([]WaveFront, WAVEFRONTS_BASE_SIZE))
 	}
+	cpt.nWF++
+	return &cpt.blocks[i][j]
+}
+
+// ARENA_MAX_POOLED_SIZE is the maximum number of offsets kept in the arena of a component
+// when the aligner is recycled, so a long alignment does not pin its memory in the pool.
+var ARENA_MAX_POOLED_SIZE = ARENA_CHUNK_SIZE << 4
 
-	wf.Set(k, offset, wfaType)
+// trim releases wavefronts and arena chunks exceeding the default capacities.
+func (cpt *Component) trim() {
+	cpt.Reset()
+	if len(cpt.WaveFronts) > WAVEFRONTS_BASE_SIZE {
+		cpt.WaveFronts = cpt.WaveFronts[:WAVEFRONTS_BASE_SIZE:WAVEFRONTS_BASE_SIZE]
+	}
+	if len(cpt.blocks) > 1 {
+		clear(cpt.blocks[1:])
+		cpt.blocks = cpt.blocks[:1]
+	}
+	cpt.arena.trim(ARENA_MAX_POOLED_SIZE)
 }
 
-// Set sets an offset which has already contain a backtrace type for a score.
-// Here, offsetWithType = offset<<wfaTypeBits | wfaType.
-func (cpt *Component) SetRaw(s uint32, k int, offset uint32) {
-	if s >= uint32(len(cpt.WaveFronts)) {
-		cpt.WaveFronts = append(cpt.WaveFronts, _WAVEFRONTS_GROW_SLICE...)
+// emptyWaveFront is returned for a score without a wavefront, it's read only.
+var emptyWaveFront = WaveFront{Lo: math.MaxInt, Hi: math.MinInt}
+
+// waveFrontAfterDiff returns the wavefront of s-diff, or the empty one if it does not exist.
+func (cpt *Component) waveFrontAfterDiff(s, diff uint32) *WaveFront {
+	if diff > s {
+		return &emptyWaveFront
+	}
+	s -= diff
+	if s >= uint32(len(cpt.WaveFronts)) || cpt.WaveFronts[s] == nil {
+		return &emptyWaveFront
 	}
+	return cpt.WaveFronts[s]
+}
+
+// wavefront returns the wavefront of a score, a new one is created if it does not exist.
+func (cpt *Component) wavefront(s uint32, k int) *WaveFront {
+	cpt.reserve(s)
 	wf := cpt.WaveFronts[s]
 	if wf == nil {
-		wf = NewWaveFront()
+		wf = cpt.newWaveFront()
 		cpt.WaveFronts[s] = wf
+
+		lo, hi := cpt.hintLo, cpt.hintHi
+		if k < lo || k > hi {
+			lo, hi = k, k
+		}
+		wf.Lo, wf.Hi = math.MaxInt, math.MinInt
+		wf.base = lo
+		wf.Offsets = cpt.arena.alloc(hi - lo + 1)
+		wf.arena = &cpt.arena
+
+		if int(s) >= cpt.nS {
+			cpt.nS = int(s) + 1
+		}
 	}
+	return wf
+}
 
-	wf.SetRaw(k, offset)
+// Set sets an offset with a given backtrace type for a score.
+func (cpt *Component) Set(s uint32, k int, offset uint32, wfaType uint32) {
+	cpt.wavefront(s, k).SetRaw(k, offset<<wfaTypeBits|wfaType)
+}
+
+// Set sets an offset which has already contain a backtrace type for a score.
+// Here, offsetWithType = offset<<wfaTypeBits | wfaType.
+func (cpt *Component) SetRaw(s uint32, k int, offset uint32) {
+	cpt.wavefront(s, k).SetRaw(k, offset)
 }
 
 // Increase increases the offset by delta.
 // Here delta does not contain the backtrace type
 func (cpt *Component) Increase(s uint32, k int, delta uint32) {
-	if s >= uint32(len(cpt.WaveFronts)) {
-		cpt.WaveFronts = append(cpt.WaveFronts, _WAVEFRONTS_GROW_SLICE...)
-	}
-	cpt.WaveFronts[s].Increase(k, delta)
+	cpt.wavefront(s, k).Increase(k, delta)
 }
 
 // Get returns offset, wfaType, existed.
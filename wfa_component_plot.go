@@ -26,6 +26,30 @@ import (
 	"sync"
 )
 
+// PlotOptions contains options for plotting a WFA component.
+type PlotOptions struct {
+	// Only plot wavefronts with scores <= MaxScore, negative values for all.
+	MaxScore int
+
+	// Do not change the types of extended cells to match.
+	NotChangeToMatch bool
+
+	// If not nil, cells of the alignment path are marked with "*".
+	// For semi-global alignment, only the aligned region is marked.
+	Path *AlignmentResult
+
+	// 1-based regions of the query (rows) and target (columns) to plot,
+	// 0 for the beginning or end of sequences.
+	QBegin, QEnd int
+	TBegin, TEnd int
+}
+
+// DefaultPlotOptions plots all cells of a component.
+var DefaultPlotOptions = &PlotOptions{
+	MaxScore:         -1,
+	NotChangeToMatch: true,
+}
+
 // Plot plots one WFA component as a tab-delimited text table.
 //
 // A table cell contains the alignment type symbol and the score.
@@ -39,24 +63,102 @@ import (
 //	⬂    Mismatch
 //	⬊    Match
 func (algn *Aligner) Plot(q, t *[]byte, wtr io.Writer, _M *Component, notChangeToMatch bool, maxScore int) {
-	M := algn.M
-	I := algn.I
-	D := algn.D
-	p := algn.p
+	algn.PlotWithOptions(q, t, wtr, _M, &PlotOptions{
+		MaxScore:         maxScore,
+		NotChangeToMatch: notChangeToMatch,
+	})
+}
+
+// PlotWithOptions plots one WFA component as a tab-delimited text table,
+// with the alignment path and a region of the matrix. See Plot() for the symbols.
+func (algn *Aligner) PlotWithOptions(q, t *[]byte, wtr io.Writer, _M *Component, opt *PlotOptions) {
+	m, qb, qe, tb, te := algn.plotMatrix(q, t, _M, opt)
+
+	var path map[[2]int]struct{}
+	if opt.Path != nil {
+		path = opt.Path.pathCells()
+	}
+
+	fmt.Fprintf(wtr, "   \t ")
+	for h := tb; h < te; h++ {
+		fmt.Fprintf(wtr, "\t%3d", h+1)
+	}
+	fmt.Fprintln(wtr)
+	fmt.Fprintf(wtr, "   \t ")
+	for _, b := range (*t)[tb:te] {
+		fmt.Fprintf(wtr, "\t%3c", b)
+	}
+	fmt.Fprintln(wtr)
 
+	var onPath bool
+	for v := qb; v < qe; v++ {
+		fmt.Fprintf(wtr, "%3d\t%c", v+1, (*q)[v]) // a base in seq t
+		for h, s := range *(*m)[v-qb] {           // a row of the matrix
+			if path != nil {
+				_, onPath = path[[2]int{v, h + tb}]
+			}
+			if s < 0 {
+				if onPath {
+					fmt.Fprintf(wtr, "\t  *")
+				} else {
+					fmt.Fprintf(wtr, "\t  .")
+				}
+			} else if onPath {
+				fmt.Fprintf(wtr, "\t%c%2d*", wfaArrows[s&int32(wfaTypeMask)], s>>int32(wfaTypeBits))
+			} else {
+				fmt.Fprintf(wtr, "\t%c%2d", wfaArrows[s&int32(wfaTypeMask)], s>>int32(wfaTypeBits))
+			}
+		}
+		fmt.Fprintln(wtr)
+	}
+
+	recycleMatrix(m)
+}
+
+// plotMatrix fills in a matrix of a region of the component, [qb, qe) x [tb, te), 0-based.
+// A cell is the score<<wfaTypeBits | type, or -1 for empty cells.
+// Remember to recycle the matrix with recycleMatrix().
+func (algn *Aligner) plotMatrix(q, t *[]byte, _M *Component, opt *PlotOptions) (m *[]*[]int32, qb, qe, tb, te int) {
 	lenQ := len(*q)
 	lenT := len(*t)
-	isM := M.IsM
+	isM := _M.IsM
+	maxScore := opt.MaxScore
+	notChangeToMatch := opt.NotChangeToMatch
+
+	// sources of cells are found with penalties of the last alignment
+	defer func(mis *posPenalties) { algn.mis = mis }(algn.mis)
+	algn.mis = algn.lastMis
+
+	// the region
+	qb, qe, tb, te = 0, lenQ, 0, lenT
+	if opt.QBegin > 0 {
+		qb = min(opt.QBegin-1, lenQ)
+	}
+	if opt.QEnd > 0 {
+		qe = max(min(opt.QEnd, lenQ), qb)
+	}
+	if opt.TBegin > 0 {
+		tb = min(opt.TBegin-1, lenT)
+	}
+	if opt.TEnd > 0 {
+		te = max(min(opt.TEnd, lenT), tb)
+	}
+	inRegion := func(v, h int) bool {
+		return v >= qb && v < qe && h >= tb && h < te
+	}
 
 	// create the matrix
-	m := poolMatrix.Get().(*[]*[]int32)
-	for range *q {
+	m = poolMatrix.Get().(*[]*[]int32)
+	for v := qb; v < qe; v++ {
 		r := poolRow.Get().(*[]int32)
-		for range *t {
+		for h := tb; h < te; h++ {
 			*r = append(*r, -1)
 		}
 		*m = append(*m, r)
 	}
+	cell := func(v, h int) *int32 {
+		return &(*(*m)[v-qb])[h-tb]
+	}
 
 	// ----------------------------------------------------------------
 	// fill in scores
@@ -94,12 +196,14 @@ func (algn *Aligner) Plot(q, t *[]byte, wtr io.Writer, _M *Component, notChangeT
 				continue
 			}
 
-			if (*(*m)[v])[h] >= 0 { // recorded with a lower score.
-				continue
-			}
+			if inRegion(v, h) {
+				if *cell(v, h) >= 0 { // recorded with a lower score.
+					continue
+				}
 
-			// fmt.Printf("    fill h (1-based):%d, v (1-based):%d\n", h+1, v+1)
-			(*(*m)[v])[h] = int32(s)<<wfaTypeBits | int32(wfaType)
+				// fmt.Printf("    fill h (1-based):%d, v (1-based):%d\n", h+1, v+1)
+				*cell(v, h) = int32(s)<<wfaTypeBits | int32(wfaType)
+			}
 
 			if !isM || (*q)[v] != (*t)[h] {
 				continue
@@ -109,23 +213,19 @@ func (algn *Aligner) Plot(q, t *[]byte, wtr io.Writer, _M *Component, notChangeT
 
 			switch wfaType {
 			case wfaInsertExt:
-				v1, _, _ = M.GetAfterDiff(uint32(s), p.GapOpen+p.GapExt, k-1)
-				v2, _, _ = I.GetAfterDiff(uint32(s), p.GapExt, k-1)
+				v1, _, v2, _ = algn.insertSources(uint32(s), k)
 				offset0 = max(v1, v2) + 1
 			case wfaDeleteExt:
-				v1, _, _ = M.GetAfterDiff(uint32(s), p.GapOpen+p.GapExt, k+1)
-				v2, _, _ = D.GetAfterDiff(uint32(s), p.GapExt, k+1)
+				v1, _, v2, _ = algn.deleteSources(uint32(s), k)
 				offset0 = max(v1, v2)
 			default:
-				v1, _, _ = M.GetAfterDiff(uint32(s), p.GapOpen+p.GapExt, k-1)
-				v2, _, _ = I.GetAfterDiff(uint32(s), p.GapExt, k-1)
+				v1, _, v2, _ = algn.insertSources(uint32(s), k)
 				Isk = max(v1, v2) + 1
 
-				v1, _, _ = M.GetAfterDiff(uint32(s), p.GapOpen+p.GapExt, k+1)
-				v2, _, _ = D.GetAfterDiff(uint32(s), p.GapExt, k+1)
+				v1, _, v2, _ = algn.deleteSources(uint32(s), k)
 				Dsk = max(v1, v2)
 
-				v1, _, _ = M.GetAfterDiff(uint32(s), p.Mismatch, k)
+				v1, _ = algn.mismatchSource(uint32(s), k)
 				offset0 = max(Isk, Dsk, v1+1)
 			}
 
@@ -139,9 +239,9 @@ func (algn *Aligner) Plot(q, t *[]byte, wtr io.Writer, _M *Component, notChangeT
 
 			// change it to match
 			v0, h0 = v, h
-			if !notChangeToMatch {
+			if !notChangeToMatch && inRegion(v0, h0) {
 				// fmt.Printf("    change %s to match: h (1-based):%d, v (1-based):%d\n", wfaType2str(wfaType), h+1, v+1)
-				(*(*m)[v0])[h0] = int32(s)<<wfaTypeBits | int32(wfaMatch)
+				*cell(v0, h0) = int32(s)<<wfaTypeBits | int32(wfaMatch)
 			}
 			n = 0
 			for {
@@ -152,15 +252,17 @@ func (algn *Aligner) Plot(q, t *[]byte, wtr io.Writer, _M *Component, notChangeT
 				}
 				n++
 
-				if (*(*m)[v])[h] >= 0 {
-					continue
-				}
-
-				if !notChangeToMatch {
-					(*(*m)[v])[h] = int32(s)<<wfaTypeBits | int32(wfaMatch) // mark as match
-					// fmt.Printf("    change %s to match: h (1-based):%d, v (1-based):%d\n", wfaType2str(wfaType), h+1, v+1)
-				} else {
-					(*(*m)[v])[h] = int32(s)<<wfaTypeBits | int32(wfaType)
+				if inRegion(v, h) {
+					if *cell(v, h) >= 0 {
+						continue
+					}
+
+					if !notChangeToMatch {
+						*cell(v, h) = int32(s)<<wfaTypeBits | int32(wfaMatch) // mark as match
+						// fmt.Printf("    change %s to match: h (1-based):%d, v (1-based):%d\n", wfaType2str(wfaType), h+1, v+1)
+					} else {
+						*cell(v, h) = int32(s)<<wfaTypeBits | int32(wfaType)
+					}
 				}
 
 				vp, hp = v, h // for the last one (or the original one in the normal order), we will restore it.
@@ -172,40 +274,62 @@ func (algn *Aligner) Plot(q, t *[]byte, wtr io.Writer, _M *Component, notChangeT
 			if n == 0 { // just itself
 				vp, hp = v0, h0
 			}
-			if !notChangeToMatch {
-				(*(*m)[vp])[hp] = int32(s)<<wfaTypeBits | int32(wfaType) // set back to the original type
+			if !notChangeToMatch && inRegion(vp, hp) {
+				*cell(vp, hp) = int32(s)<<wfaTypeBits | int32(wfaType) // set back to the original type
 				// fmt.Printf("    change %s back: h (1-based):%d, v (1-based):%d\n", wfaType2str(wfaType), h+1, v+1)
 			}
 		}
 	}
 
-	// ----------------------------------------------------------------
-	// sequence q
+	return m, qb, qe, tb, te
+}
 
-	fmt.Fprintf(wtr, "   \t ")
-	for h := range *t {
-		fmt.Fprintf(wtr, "\t%3d", h+1)
-	}
-	fmt.Fprintln(wtr)
-	fmt.Fprintf(wtr, "   \t ")
-	for _, b := range *t {
-		fmt.Fprintf(wtr, "\t%3c", b)
+// pathCells returns 0-based positions (v, h) of the matrix cells an alignment passes through.
+// A gap is placed at the row or column of the last aligned base of the other sequence.
+// For semi-global alignment, only the aligned region is included.
+func (cigar *AlignmentResult) pathCells() map[[2]int]struct{} {
+	cigar.process()
+	ops := cigar.Ops
+
+	begin, end := 0, len(ops)-1
+	if !cigar.globalAlignment {
+		for begin < len(ops) && !isMatchOrMismatch(ops[begin]) {
+			begin++
+		}
+		for end >= 0 && !isMatchOrMismatch(ops[end]) {
+			end--
+		}
 	}
-	fmt.Fprintln(wtr)
 
-	for v, b := range *q {
-		fmt.Fprintf(wtr, "%3d\t%c", v+1, b) // a base in seq t
-		for _, s := range *(*m)[v] {        // a row of the matrix
-			if s < 0 {
-				fmt.Fprintf(wtr, "\t  .")
-			} else {
-				fmt.Fprintf(wtr, "\t%c%2d", wfaArrows[s&int32(wfaTypeMask)], s>>int32(wfaTypeBits))
+	cells := make(map[[2]int]struct{}, cigar.AlignLen)
+	var v, h int // 0-based positions of the next bases
+	var n, j int
+	for i, op := range ops {
+		n = int(op & MaskLower32)
+		for j = 0; j < n; j++ {
+			switch op >> 32 {
+			case OpM, OpX:
+				if i >= begin && i <= end {
+					cells[[2]int{v, h}] = struct{}{}
+				}
+				v++
+				h++
+			case OpI:
+				if i >= begin && i <= end && v > 0 {
+					cells[[2]int{v - 1, h}] = struct{}{}
+				}
+				h++
+			case OpD:
+				if i >= begin && i <= end && h > 0 {
+					cells[[2]int{v, h - 1}] = struct{}{}
+				}
+				v++
+			case OpH:
+				v++
 			}
 		}
-		fmt.Fprintln(wtr)
 	}
-
-	recycleMatrix(m)
+	return cells
 }
 
 var poolMatrix = &sync.Pool{New: func() interface{} {
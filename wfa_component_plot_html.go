@@ -0,0 +1,297 @@
+// Copyright © 2024 Wei Shen <shenwei356@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package wfa
+
+import (
+	"bufio"
+	"fmt"
+	"html"
+	"io"
+)
+
+// colours of backtrace types in PlotHTML().
+var wfaColors = []string{"#e0e0e0", "#90caf9", "#e3f2fd", "#ce93d8", "#f3e5f5", "#ffcc80", "#a5d6a7"}
+
+// names of backtrace types in PlotHTML().
+var wfaTypeNames = []string{"Unknown", "Gap open (Insertion)", "Gap extension (Insertion)",
+	"Gap open (Deletion)", "Gap extension (Deletion)", "Mismatch", "Match"}
+
+// PlotHTML plots one WFA component as a standalone HTML table colour-coded by backtrace types.
+// Options are the same as PlotWithOptions(), and cells of the alignment path are outlined.
+// It is only suitable for small regions, as every cell is a table cell.
+func (algn *Aligner) PlotHTML(q, t *[]byte, wtr io.Writer, _M *Component, opt *PlotOptions) error {
+	m, qb, qe, tb, te := algn.plotMatrix(q, t, _M, opt)
+	defer recycleMatrix(m)
+
+	var path map[[2]int]struct{}
+	if opt.Path != nil {
+		path = opt.Path.pathCells()
+	}
+
+	bw := bufio.NewWriter(wtr)
+
+	bw.WriteString(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>WFA component</title>
+<style>
+table { border-collapse: collapse; font-family: monospace; font-size: 12px; }
+th, td { border: 1px solid #f5f5f5; padding: 1px 3px; text-align: center; white-space: nowrap; }
+th { background: #fafafa; }
+td.p { outline: 2px solid #d32f2f; outline-offset: -2px; font-weight: bold; }
+`)
+	for i, c := range wfaColors {
+		fmt.Fprintf(bw, "td.t%d { background: %s; }\n", i, c)
+	}
+	bw.WriteString("</style>\n</head>\n<body>\n")
+
+	// legend
+	bw.WriteString("<table>\n")
+	for i, name := range wfaTypeNames {
+		fmt.Fprintf(bw, "<tr><td class=\"t%d\">%c</td><td>%s</td></tr>\n", i, wfaArrows[i], name)
+	}
+	if path != nil {
+		bw.WriteString("<tr><td class=\"p\"></td><td>Alignment path</td></tr>\n")
+	}
+	bw.WriteString("</table>\n<br>\n")
+
+	// the matrix
+	bw.WriteString("<table>\n<tr><th></th><th></th>")
+	for h := tb; h < te; h++ {
+		fmt.Fprintf(bw, "<th>%d</th>", h+1)
+	}
+	bw.WriteString("</tr>\n<tr><th></th><th></th>")
+	for _, b := range (*t)[tb:te] {
+		fmt.Fprintf(bw, "<th>%s</th>", html.EscapeString(string(b)))
+	}
+	bw.WriteString("</tr>\n")
+
+	var onPath bool
+	var wfaType int32
+	for v := qb; v < qe; v++ {
+		fmt.Fprintf(bw, "<tr><th>%d</th><th>%s</th>", v+1, html.EscapeString(string((*q)[v])))
+		for h, s := range *(*m)[v-qb] {
+			if path != nil {
+				_, onPath = path[[2]int{v, h + tb}]
+			}
+			if s < 0 {
+				if onPath {
+					bw.WriteString(`<td class="p"></td>`)
+				} else {
+					bw.WriteString("<td></td>")
+				}
+				continue
+			}
+
+			wfaType = s & int32(wfaTypeMask)
+			if onPath {
+				fmt.Fprintf(bw, `<td class="t%d p"`, wfaType)
+			} else {
+				fmt.Fprintf(bw, `<td class="t%d"`, wfaType)
+			}
+			fmt.Fprintf(bw, ` title="(%d, %d) %s, score: %d">%c%d</td>`,
+				v+1, h+tb+1, wfaTypeNames[wfaType], s>>int32(wfaTypeBits),
+				wfaArrows[wfaType], s>>int32(wfaTypeBits))
+		}
+		bw.WriteString("</tr>\n")
+	}
+	bw.WriteString("</table>\n</body>\n</html>\n")
+
+	return bw.Flush()
+}
+
+// SVGPlotOptions contains options for PlotSVG().
+type SVGPlotOptions struct {
+	// Width of the plot in pixels, the height is scaled with the sequence lengths.
+	Width int
+
+	// Size of a dot in pixels, all matrix cells in it are merged.
+	DotSize int
+
+	// Only plot wavefronts with scores <= MaxScore, negative values for all.
+	MaxScore int
+
+	// If not nil, the alignment path is drawn.
+	Path *AlignmentResult
+}
+
+// DefaultSVGPlotOptions is the default option of PlotSVG().
+var DefaultSVGPlotOptions = &SVGPlotOptions{
+	Width:    800,
+	DotSize:  2,
+	MaxScore: -1,
+}
+
+// PlotSVG plots the M component of the last alignment as a dot plot in SVG format,
+// where the target is on the x axis and the query on the y axis.
+// Furthest-reaching points of the wavefronts are coloured from blue (low scores) to red (high scores),
+// diagonals deleted in adaptive reduction are grey if they are recorded (see RecordPruned()),
+// and the alignment path is black.
+// Matrix cells are merged into dots, so it works for sequences of tens of kb.
+func (algn *Aligner) PlotSVG(q, t *[]byte, wtr io.Writer, opt *SVGPlotOptions) error {
+	lenQ, lenT := len(*q), len(*t)
+	if lenQ == 0 || lenT == 0 {
+		return ErrEmptySeq
+	}
+	width := max(opt.Width, 1)
+	dot := max(opt.DotSize, 1)
+	scale := float64(width) / float64(lenT) // pixels per base
+	height := max(int(float64(lenQ)*scale+0.5), 1)
+
+	// dots, the minimum score of merged cells, -1 for empty ones.
+	cols, rows := (width+dot-1)/dot, (height+dot-1)/dot
+	dots := make([]int32, cols*rows)
+	for i := range dots {
+		dots[i] = -1
+	}
+	pruned := make([]bool, cols*rows)
+	index := func(v, h int) int { // 1-based positions
+		x := min(int(float64(h-1)*scale)/dot, cols-1)
+		y := min(int(float64(v-1)*scale)/dot, rows-1)
+		return y*cols + x
+	}
+
+	var maxS int
+	var h, v, i int
+	M := algn.M
+	for s, wf := range M.WaveFronts {
+		if wf == nil {
+			continue
+		}
+		if opt.MaxScore >= 0 && s > opt.MaxScore {
+			break
+		}
+		for k := wf.Lo; k <= wf.Hi; k++ {
+			offset, _, ok := wf.Get(k)
+			if !ok {
+				continue
+			}
+			h = int(offset)
+			v = h - k
+			if v < 1 || h < 1 || v > lenQ || h > lenT {
+				continue
+			}
+			i = index(v, h)
+			if dots[i] < 0 {
+				dots[i] = int32(s)
+			}
+			maxS = s
+		}
+	}
+	for _, d := range algn.pruned {
+		if opt.MaxScore >= 0 && int(d.s) > opt.MaxScore {
+			continue
+		}
+		h = int(d.offset)
+		v = h - d.k
+		if v < 1 || h < 1 || v > lenQ || h > lenT {
+			continue
+		}
+		pruned[index(v, h)] = true
+	}
+
+	bw := bufio.NewWriter(wtr)
+	const margin = 20
+	fmt.Fprintf(bw, `<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="%d" viewBox="0 0 %d %d">`+"\n",
+		width+2*margin, height+2*margin, width+2*margin, height+2*margin)
+	fmt.Fprintf(bw, `<rect x="%d" y="%d" width="%d" height="%d" fill="white" stroke="#9e9e9e"/>`+"\n",
+		margin, margin, width, height)
+	fmt.Fprintf(bw, `<text x="%d" y="%d" font-family="sans-serif" font-size="12">target (%d)</text>`+"\n",
+		margin, margin-6, lenT)
+	fmt.Fprintf(bw, `<text x="%d" y="%d" font-family="sans-serif" font-size="12" transform="rotate(-90 %d %d)" text-anchor="end">query (%d)</text>`+"\n",
+		margin-6, margin, margin-6, margin, lenQ)
+
+	fmt.Fprintf(bw, `<g transform="translate(%d,%d)">`+"\n", margin, margin)
+
+	// pruned diagonals
+	for i, p := range pruned {
+		if p {
+			fmt.Fprintf(bw, `<rect x="%d" y="%d" width="%d" height="%d" fill="#bdbdbd"/>`+"\n",
+				i%cols*dot, i/cols*dot, dot, dot)
+		}
+	}
+
+	// wavefronts
+	var f float64
+	for i, s := range dots {
+		if s < 0 {
+			continue
+		}
+		f = 0
+		if maxS > 0 {
+			f = float64(s) / float64(maxS)
+		}
+		fmt.Fprintf(bw, `<rect x="%d" y="%d" width="%d" height="%d" fill="rgb(%d,0,%d)"/>`+"\n",
+			i%cols*dot, i/cols*dot, dot, dot, int(255*f), int(255*(1-f)))
+	}
+
+	// the alignment path
+	if opt.Path != nil {
+		bw.WriteString(`<polyline fill="none" stroke="black" stroke-width="1" points="`)
+		for _, p := range opt.Path.pathPoints() {
+			fmt.Fprintf(bw, "%.1f,%.1f ", float64(p[1])*scale, float64(p[0])*scale)
+		}
+		bw.WriteString("\"/>\n")
+	}
+
+	bw.WriteString("</g>\n</svg>\n")
+	return bw.Flush()
+}
+
+// pathPoints returns 0-based positions (v, h) of the boundaries of operations in the aligned region,
+// i.e., vertexes of the alignment path in a dot plot.
+func (cigar *AlignmentResult) pathPoints() [][2]int {
+	cigar.process()
+	ops := cigar.Ops
+
+	begin, end := 0, len(ops)-1
+	if !cigar.globalAlignment {
+		for begin < len(ops) && !isMatchOrMismatch(ops[begin]) {
+			begin++
+		}
+		for end >= 0 && !isMatchOrMismatch(ops[end]) {
+			end--
+		}
+	}
+
+	points := make([][2]int, 0, len(ops)+1)
+	var v, h, n int // 0-based positions of the next bases
+	for i, op := range ops {
+		if i == begin {
+			points = append(points, [2]int{v, h})
+		}
+		n = int(op & MaskLower32)
+		switch op >> 32 {
+		case OpM, OpX:
+			v += n
+			h += n
+		case OpI:
+			h += n
+		case OpD, OpH:
+			v += n
+		}
+		if i >= begin && i <= end {
+			points = append(points, [2]int{v, h})
+		}
+	}
+	return points
+}
@@ -0,0 +1,79 @@
+// Copyright © 2024 Wei Shen <shenwei356@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package wfa
+
+import "fmt"
+
+// Constraint forces query[QBegin:QEnd] to be aligned to target[TBegin:TEnd].
+// Positions are 0-based and ends are exclusive, like slice indexes.
+type Constraint struct {
+	QBegin, QEnd int
+	TBegin, TEnd int
+}
+
+// ErrInvalidConstraint means constraints are out of range, or unordered, or overlapping.
+var ErrInvalidConstraint error = fmt.Errorf("wfa: invalid constraint")
+
+// AlignWithConstraints performs global alignment which is forced through the given regions,
+// e.g., primers or known exons. Constraints should be sorted and not overlapping.
+// Each constraint region and the segments between them are aligned separately,
+// and the operations of all pieces are merged into one alignment.
+//
+// The score is the sum of scores of all pieces, except that a gap spanning
+// a boundary of two pieces is only penalized with one gap opening.
+// Global alignment is always performed, no matter what Options.GlobalAlignment is.
+func (algn *Aligner) AlignWithConstraints(q, t []byte, constraints []Constraint) (*AlignmentResult, error) {
+	if len(q) == 0 || len(t) == 0 {
+		return nil, ErrEmptySeq
+	}
+	var v, h int // ends of the previous constraint
+	for _, c := range constraints {
+		if c.QBegin < v || c.QEnd < c.QBegin || c.QEnd > len(q) ||
+			c.TBegin < h || c.TEnd < c.TBegin || c.TEnd > len(t) {
+			return nil, ErrInvalidConstraint
+		}
+		v, h = c.QEnd, c.TEnd
+	}
+
+	defer algn.setGlobalAlignment(true)()
+
+	cigar := NewAlignmentResult(true)
+	var err error
+	v, h = 0, 0
+	for _, c := range constraints {
+		if err = algn.alignPiece(cigar, q[v:c.QBegin], t[h:c.TBegin]); err != nil {
+			RecycleAlignmentResult(cigar)
+			return nil, err
+		}
+		if err = algn.alignPiece(cigar, q[c.QBegin:c.QEnd], t[c.TBegin:c.TEnd]); err != nil {
+			RecycleAlignmentResult(cigar)
+			return nil, err
+		}
+		v, h = c.QEnd, c.TEnd
+	}
+	if err = algn.alignPiece(cigar, q[v:], t[h:]); err != nil {
+		RecycleAlignmentResult(cigar)
+		return nil, err
+	}
+	algn.finishPieces(cigar, q, t)
+
+	return cigar, nil
+}
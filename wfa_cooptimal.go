@@ -0,0 +1,352 @@
+// Copyright © 2024 Wei Shen <shenwei356@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package wfa
+
+import (
+	"fmt"
+	"math/rand"
+)
+
+// ErrInvalidNumberOfAlignments means the number of alignments to return is not positive.
+var ErrInvalidNumberOfAlignments error = fmt.Errorf("wfa: the number of alignments should be positive")
+
+// AlignCoOptimal returns up to n alignments of the optimal score,
+// and the total number of co-optimal alignments, which might be larger than n
+// and inexact if it exceeds the precision of float64.
+//
+// Alignments are searched backwards in the computed wavefronts, where furthest-reaching offsets
+// are used as upper bounds of offsets of all alignments of a score.
+// Memory usage grows with the number of states of co-optimal alignments, so it is only
+// suitable for short sequences or similar ones. With adaptive reduction,
+// only co-optimal alignments in the kept diagonals are found.
+// Indels are not normalized with Options.IndelAlignment.
+func (algn *Aligner) AlignCoOptimal(q, t []byte, n int) ([]*AlignmentResult, float64, error) {
+	if n <= 0 {
+		return nil, 0, ErrInvalidNumberOfAlignments
+	}
+	co, ends, total, err := algn.coOptimal(q, t)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	results := make([]*AlignmentResult, 0, min(n, int(min(total, 1024))))
+	var end coState
+	var dfs func(steps []coStep) bool // returns false to stop
+	dfs = func(steps []coStep) bool {
+		for _, p := range steps {
+			if co.stepCount(p) == 0 {
+				continue
+			}
+			if p.op > 0 {
+				co.ops = append(co.ops, p.op)
+			}
+			if p.start {
+				results = append(results, co.result(end, p.st))
+			} else if !dfs(co.preds(p.st)) {
+				return false
+			}
+			if p.op > 0 {
+				co.ops = co.ops[:len(co.ops)-1]
+			}
+			if len(results) >= n {
+				return false
+			}
+		}
+		return true
+	}
+	for _, end = range ends {
+		if len(results) >= n {
+			break
+		}
+		co.ops = co.ops[:0]
+		dfs(co.preds(end))
+	}
+	return results, total, nil
+}
+
+// SampleCoOptimal samples n alignments uniformly from all alignments of the optimal score,
+// with replacement. The random number generator r is used, or the global one if it is nil.
+// An empty slice is returned if no alignments are found, e.g., all are dropped in adaptive reduction.
+// See AlignCoOptimal() for the limitations.
+func (algn *Aligner) SampleCoOptimal(q, t []byte, n int, r *rand.Rand) ([]*AlignmentResult, error) {
+	if n <= 0 {
+		return nil, ErrInvalidNumberOfAlignments
+	}
+	co, ends, total, err := algn.coOptimal(q, t)
+	if err != nil {
+		return nil, err
+	}
+	if len(ends) == 0 {
+		return []*AlignmentResult{}, nil
+	}
+	random := rand.Float64
+	if r != nil {
+		random = r.Float64
+	}
+
+	// choose returns the index of a weighted choice.
+	choose := func(weights []float64, sum float64) int {
+		x := random() * sum
+		last := -1
+		for i, w := range weights {
+			if w <= 0 {
+				continue
+			}
+			if x < w {
+				return i
+			}
+			x -= w
+			last = i
+		}
+		return last // rounding error
+	}
+
+	endCounts := make([]float64, len(ends))
+	for i, end := range ends {
+		endCounts[i] = co.count(end)
+	}
+
+	results := make([]*AlignmentResult, 0, n)
+	weights := make([]float64, 0, 4)
+	var sum float64
+	for len(results) < n {
+		end := ends[choose(endCounts, total)]
+		co.ops = co.ops[:0]
+		steps := co.preds(end)
+		for {
+			weights, sum = weights[:0], 0
+			for _, p := range steps {
+				weights = append(weights, co.stepCount(p))
+				sum += weights[len(weights)-1]
+			}
+			p := steps[choose(weights, sum)]
+			if p.op > 0 {
+				co.ops = append(co.ops, p.op)
+			}
+			if p.start {
+				results = append(results, co.result(end, p.st))
+				break
+			}
+			steps = co.preds(p.st)
+		}
+	}
+	return results, nil
+}
+
+// components of states of co-optimal alignments.
+const (
+	coM uint8 = iota
+	coI
+	coD
+)
+
+// coState is a state of alignments, i.e., an alignment of a score ending at
+// offset h of diagonal k in a component.
+type coState struct {
+	c uint8
+	s uint32
+	k int
+	h int
+}
+
+// coStep is a predecessor of a state, with the operation between them.
+type coStep struct {
+	st    coState
+	op    byte // 0 for none
+	start bool // the state itself is the start cell of alignments
+}
+
+// coOptimal searches co-optimal alignments in computed wavefronts.
+type coOptimal struct {
+	algn   *Aligner
+	seqs   sequences
+	lenQ   int
+	lenT   int
+	score  uint32
+	counts map[coState]float64 // numbers of alignments from start cells to states
+	ops    []byte              // operations in reversed order
+}
+
+// coOptimal computes the wavefronts, and returns the end states and the number of co-optimal alignments.
+func (algn *Aligner) coOptimal(q, t []byte) (*coOptimal, []coState, float64, error) {
+	seqs := algn.bytes(&q, &t)
+	s, lastK, err := algn.compute(seqs)
+	if err != nil {
+		return nil, nil, 0, err
+	}
+	n, m := seqs.lens()
+	co := &coOptimal{
+		algn:   algn,
+		seqs:   seqs,
+		lenQ:   n,
+		lenT:   m,
+		score:  s,
+		counts: make(map[coState]float64, 1024),
+		ops:    make([]byte, 0, n+m),
+	}
+
+	// end states
+	ends := make([]coState, 0, 8)
+	if algn.opt.GlobalAlignment {
+		ends = append(ends, coState{c: coM, s: s, k: lastK, h: lastK + n})
+	} else { // the last row or column, the same as backtraceStartPosistion()
+		lo, hi := algn.M.KRange(s, 0)
+		for k := lo; k <= hi; k++ {
+			if st := (coState{c: coM, s: s, k: k, h: n + k}); k >= 0 && co.possible(st) {
+				ends = append(ends, st)
+			}
+			if st := (coState{c: coM, s: s, k: k, h: m}); k <= 0 && !(k == 0 && m == n) && co.possible(st) {
+				ends = append(ends, st)
+			}
+		}
+	}
+
+	var total float64
+	j := 0
+	for _, end := range ends {
+		if x := co.count(end); x > 0 {
+			total += x
+			ends[j] = end
+			j++
+		}
+	}
+	return co, ends[:j], total, nil
+}
+
+// possible checks whether a state might exist, with the furthest-reaching offset as the upper bound.
+func (co *coOptimal) possible(st coState) bool {
+	v := st.h - st.k
+	if st.h < 1 || v < 1 || st.h > co.lenT || v > co.lenQ {
+		return false
+	}
+	var cpt *Component
+	switch st.c {
+	case coM:
+		cpt = co.algn.M
+	case coI:
+		cpt = co.algn.I
+	default:
+		cpt = co.algn.D
+	}
+	offset, _, ok := cpt.Get(st.s, st.k)
+	return ok && st.h <= int(offset)
+}
+
+// count returns the number of alignments from start cells to a state.
+func (co *coOptimal) count(st coState) float64 {
+	if !co.possible(st) {
+		return 0
+	}
+	if x, ok := co.counts[st]; ok {
+		return x
+	}
+	var x float64
+	for _, p := range co.preds(st) {
+		x += co.stepCount(p)
+	}
+	co.counts[st] = x
+	return x
+}
+
+// stepCount returns the number of alignments from start cells via a predecessor.
+func (co *coOptimal) stepCount(p coStep) float64 {
+	if p.start {
+		return 1
+	}
+	return co.count(p.st)
+}
+
+// preds returns all possible predecessors of a state.
+func (co *coOptimal) preds(st coState) []coStep {
+	algn := co.algn
+	s, k, h := st.s, st.k, st.h
+	v := h - k
+	steps := make([]coStep, 0, 4)
+	var x uint32
+	switch st.c {
+	case coM:
+		eq := co.seqs.equal(v-1, h-1)
+		if v == 1 && h == 1 || !algn.opt.GlobalAlignment && (v == 1 || h == 1) { // the start cell
+			op, x := byte('M'), uint32(0)
+			if !eq {
+				op, x = 'X', algn.mismatchPenalty(v)
+			}
+			if s == x {
+				steps = append(steps, coStep{st: st, op: op, start: true})
+			}
+		}
+		if v > 1 && h > 1 {
+			if eq {
+				steps = append(steps, coStep{st: coState{c: coM, s: s, k: k, h: h - 1}, op: 'M'})
+			} else if x = algn.mismatchPenalty(v); x <= s {
+				steps = append(steps, coStep{st: coState{c: coM, s: s - x, k: k, h: h - 1}, op: 'X'})
+			}
+		}
+		steps = append(steps, coStep{st: coState{c: coI, s: s, k: k, h: h}})
+		steps = append(steps, coStep{st: coState{c: coD, s: s, k: k, h: h}})
+	case coI: // one more base of the target
+		if h > 1 {
+			if x = algn.gapPenalty(wfaInsertOpen, v, h); x <= s {
+				steps = append(steps, coStep{st: coState{c: coM, s: s - x, k: k - 1, h: h - 1}, op: 'I'})
+			}
+			if x = algn.gapPenalty(wfaInsertExt, v, h); x <= s {
+				steps = append(steps, coStep{st: coState{c: coI, s: s - x, k: k - 1, h: h - 1}, op: 'I'})
+			}
+		}
+	default: // one more base of the query
+		if v > 1 {
+			if x = algn.gapPenalty(wfaDeleteOpen, v, h); x <= s {
+				steps = append(steps, coStep{st: coState{c: coM, s: s - x, k: k + 1, h: h}, op: 'D'})
+			}
+			if x = algn.gapPenalty(wfaDeleteExt, v, h); x <= s {
+				steps = append(steps, coStep{st: coState{c: coD, s: s - x, k: k + 1, h: h}, op: 'D'})
+			}
+		}
+	}
+	return steps
+}
+
+// result creates an alignment from the operations between the end state and the start cell.
+func (co *coOptimal) result(end, start coState) *AlignmentResult {
+	cigar := NewAlignmentResult(co.algn.opt.GlobalAlignment)
+	cigar.Score = co.score
+
+	h, v := end.h, end.h-end.k
+	if h < co.lenT {
+		cigar.AddN(wfaOps[wfaInsertOpen], uint32(co.lenT-h))
+	} else if v < co.lenQ {
+		cigar.AddN('H', uint32(co.lenQ-v))
+	}
+	for _, op := range co.ops {
+		cigar.AddN(op, 1)
+	}
+	h, v = start.h, start.h-start.k
+	if v > 1 {
+		cigar.AddN('H', uint32(v-1))
+	}
+	if h > 1 {
+		cigar.AddN(wfaOps[wfaInsertOpen], uint32(h-1))
+	}
+
+	cigar.process()
+	cigar.locate()
+	return cigar
+}
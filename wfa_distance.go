@@ -0,0 +1,233 @@
+// Copyright © 2024 Wei Shen <shenwei356@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package wfa
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"runtime"
+	"sync"
+)
+
+// DistanceMetric is the metric of pairwise distances.
+type DistanceMetric uint8
+
+const (
+	DistanceScore                 DistanceMetric = iota // alignment score, computed without backtrace
+	DistanceBLASTIdentity                               // 1 - BLAST identity
+	DistanceGapCompressedIdentity                       // 1 - gap-compressed identity
+	DistanceEditDistanceIdentity                        // 1 - edit-distance-based identity
+)
+
+// ErrInvalidDistanceMetric means the distance metric is not supported.
+var ErrInvalidDistanceMetric error = fmt.Errorf("wfa: invalid distance metric")
+
+// ErrInvalidNames means the number of names does not match the size of the distance matrix.
+var ErrInvalidNames error = fmt.Errorf("wfa: the number of names does not match the size of the distance matrix")
+
+// DistanceOptions contains the options for computing pairwise distances.
+type DistanceOptions struct {
+	Penalties         *Penalties               // DefaultPenalties is used if nil
+	Options           *Options                 // DefaultOptions is used if nil
+	AdaptiveReduction *AdaptiveReductionOption // nil for no adaptive reduction
+	Metric            DistanceMetric
+	Threads           int // the number of goroutines, 0 for all CPUs
+}
+
+// DistanceMatrix is a symmetric distance matrix, only the upper triangle is stored.
+type DistanceMatrix struct {
+	N      int
+	values []float64 // row-major upper triangle, excluding the diagonal.
+}
+
+// Get returns the distance between the i-th and j-th sequences.
+func (m *DistanceMatrix) Get(i, j int) float64 {
+	if i == j {
+		return 0
+	}
+	if i > j {
+		i, j = j, i
+	}
+	return m.values[m.index(i, j)]
+}
+
+// index returns the index of (i, j) in the upper triangle, where i < j.
+func (m *DistanceMatrix) index(i, j int) int {
+	return i*(2*m.N-i-1)/2 + j - i - 1
+}
+
+// PairwiseDistances computes distances of all pairs of sequences in parallel.
+func PairwiseDistances(seqs [][]byte, opt *DistanceOptions) (*DistanceMatrix, error) {
+	if opt.Metric > DistanceEditDistanceIdentity {
+		return nil, ErrInvalidDistanceMetric
+	}
+	for _, s := range seqs {
+		if len(s) == 0 {
+			return nil, ErrEmptySeq
+		}
+	}
+	p, o := opt.Penalties, opt.Options
+	if p == nil {
+		p = DefaultPenalties
+	}
+	if o == nil {
+		o = DefaultOptions
+	}
+	threads := opt.Threads
+	if threads <= 0 {
+		threads = runtime.NumCPU()
+	}
+
+	n := len(seqs)
+	m := &DistanceMatrix{N: n, values: make([]float64, n*(n-1)/2)}
+
+	// pairs are sent in small chunks to balance the work of the upper triangle.
+	size := max(1, min(distanceChunkSize, len(m.values)/(threads*4)))
+	chunks := make(chan [][2]int, threads)
+	done := make(chan struct{}) // closed on the first error
+	var once sync.Once
+	var err0 error
+	var wg sync.WaitGroup
+	for w := 0; w < threads; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			algn := New(p, o)
+			defer RecycleAligner(algn)
+			if opt.AdaptiveReduction != nil {
+				algn.AdaptiveReduction(opt.AdaptiveReduction)
+			}
+
+			var d float64
+			var err error
+			for chunk := range chunks {
+				for _, ij := range chunk {
+					select {
+					case <-done:
+						return
+					default:
+					}
+					if d, err = algn.distance(seqs[ij[0]], seqs[ij[1]], opt.Metric); err != nil {
+						once.Do(func() {
+							err0 = err
+							close(done)
+						})
+						return
+					}
+					m.values[m.index(ij[0], ij[1])] = d
+				}
+			}
+		}()
+	}
+
+	chunk := make([][2]int, 0, size)
+LOOP:
+	for i := 0; i < n-1; i++ {
+		for j := i + 1; j < n; j++ {
+			chunk = append(chunk, [2]int{i, j})
+			if len(chunk) < size && !(i == n-2 && j == n-1) {
+				continue
+			}
+			select {
+			case chunks <- chunk:
+				chunk = make([][2]int, 0, size)
+			case <-done:
+				break LOOP
+			}
+		}
+	}
+	close(chunks)
+	wg.Wait()
+
+	if err0 != nil {
+		return nil, err0
+	}
+	return m, nil
+}
+
+// distanceChunkSize is the maximum number of pairs in a job of PairwiseDistances.
+const distanceChunkSize = 64
+
+// distance computes the distance of two sequences.
+func (algn *Aligner) distance(q, t []byte, metric DistanceMetric) (float64, error) {
+	seqs := algn.bytes(&q, &t)
+
+	if metric == DistanceScore { // score-only alignment
+		s, _, err := algn.compute(seqs)
+		return float64(s), err
+	}
+
+	result, err := algn.align(seqs)
+	if err != nil {
+		return 0, err
+	}
+	var d float64
+	switch metric {
+	case DistanceBLASTIdentity:
+		d = 1 - result.Stats.BLASTIdentity()
+	case DistanceGapCompressedIdentity:
+		d = 1 - result.Stats.GapCompressedIdentity()
+	default:
+		d = 1 - result.Stats.EditDistanceIdentity()
+	}
+	RecycleAlignmentResult(result)
+	return d, nil
+}
+
+// WritePHYLIP writes the matrix in the (relaxed) PHYLIP format.
+// Names are padded to 10 characters, longer names are kept as they are.
+func (m *DistanceMatrix) WritePHYLIP(w io.Writer, names []string) error {
+	if len(names) != m.N {
+		return ErrInvalidNames
+	}
+	bw := bufio.NewWriter(w)
+	fmt.Fprintf(bw, "%d\n", m.N)
+	for i := 0; i < m.N; i++ {
+		fmt.Fprintf(bw, "%-10s", names[i])
+		for j := 0; j < m.N; j++ {
+			fmt.Fprintf(bw, " %.6g", m.Get(i, j))
+		}
+		bw.WriteByte('\n')
+	}
+	return bw.Flush()
+}
+
+// WriteTSV writes the matrix in a tab-delimited table with a header row of names.
+func (m *DistanceMatrix) WriteTSV(w io.Writer, names []string) error {
+	if len(names) != m.N {
+		return ErrInvalidNames
+	}
+	bw := bufio.NewWriter(w)
+	for j := 0; j < m.N; j++ {
+		bw.WriteByte('\t')
+		bw.WriteString(names[j])
+	}
+	bw.WriteByte('\n')
+	for i := 0; i < m.N; i++ {
+		bw.WriteString(names[i])
+		for j := 0; j < m.N; j++ {
+			fmt.Fprintf(bw, "\t%.6g", m.Get(i, j))
+		}
+		bw.WriteByte('\n')
+	}
+	return bw.Flush()
+}
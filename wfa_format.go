@@ -0,0 +1,207 @@
+// Copyright © 2024 Wei Shen <shenwei356@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package wfa
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+)
+
+// FormatOptions contains the options for formatting alignment text.
+type FormatOptions struct {
+	Width int // the number of columns in each line, 0 for no wrapping.
+
+	QueryName  string
+	TargetName string
+
+	// Symbols of the match line: '|' for matches, ':' for transitions (A<->G, C<->T),
+	// and '.' for other mismatches. By default, only matches are marked with '|'.
+	Symbols bool
+
+	Color bool // highlight mismatches with ANSI colour.
+
+	OnlyAlignedRegion bool // only show the aligned region.
+}
+
+// DefaultFormatOptions is the default formatting options.
+var DefaultFormatOptions = FormatOptions{
+	Width:      60,
+	QueryName:  "query",
+	TargetName: "target",
+	Symbols:    true,
+}
+
+const colorMismatch = "\x1b[31m"
+const colorReset = "\x1b[0m"
+
+// WriteAlignment writes the wrapped alignment text with a summary header and coordinates,
+// like the pairwise alignment output of BLAST.
+// q and t are the query and target sequences used in the alignment.
+// opt could be nil for DefaultFormatOptions.
+func (cigar *AlignmentResult) WriteAlignment(w io.Writer, q, t *[]byte, opt *FormatOptions) error {
+	if opt == nil {
+		opt = &DefaultFormatOptions
+	}
+	cigar.process()
+
+	qName, tName := opt.QueryName, opt.TargetName
+	if qName == "" {
+		qName = "query"
+	}
+	if tName == "" {
+		tName = "target"
+	}
+
+	bw := bufio.NewWriter(w)
+
+	// ----------------------------------------------------------------
+	// header
+
+	fmt.Fprintf(bw, "# Query:    %s (%d bp)\n", qName, len(*q))
+	fmt.Fprintf(bw, "# Target:   %s (%d bp)\n", tName, len(*t))
+	fmt.Fprintf(bw, "# Score:    %d\n", cigar.Score)
+	fmt.Fprintf(bw, "# Region:   q[%d, %d] vs t[%d, %d]\n", cigar.QBegin, cigar.QEnd, cigar.TBegin, cigar.TEnd)
+	fmt.Fprintf(bw, "# Length:   %d\n", cigar.AlignLen)
+	fmt.Fprintf(bw, "# Identity: %d/%d (%.2f%%)\n", cigar.Matches, cigar.AlignLen, percentage(cigar.Matches, cigar.AlignLen))
+	fmt.Fprintf(bw, "# Gaps:     %d/%d (%.2f%%)\n", cigar.Gaps, cigar.AlignLen, percentage(cigar.Gaps, cigar.AlignLen))
+	bw.WriteByte('\n')
+
+	// ----------------------------------------------------------------
+	// alignment
+
+	Q, A, T := cigar.AlignmentText(q, t, opt.OnlyAlignedRegion)
+	defer RecycleAlignmentText(Q, A, T)
+
+	if opt.Symbols {
+		for i, c := range *A {
+			if c == ' ' && isAlignedColumn(Q, T, i) {
+				if isTransition((*Q)[i], (*T)[i]) {
+					(*A)[i] = ':'
+				} else {
+					(*A)[i] = '.'
+				}
+			}
+		}
+	}
+
+	// 0-based positions of the last bases
+	var qPos, tPos int
+	if opt.OnlyAlignedRegion {
+		qPos, tPos = cigar.QBegin-1, cigar.TBegin-1
+	}
+
+	wName := len(qName)
+	if len(tName) > wName {
+		wName = len(tName)
+	}
+	wPos := len(strconv.Itoa(len(*q)))
+	if l := len(strconv.Itoa(len(*t))); l > wPos {
+		wPos = l
+	}
+	padding := make([]byte, wName+wPos+2)
+	for i := range padding {
+		padding[i] = ' '
+	}
+
+	width := opt.Width
+	if width <= 0 {
+		width = len(*A)
+	}
+
+	var end int
+	for start := 0; start < len(*A); start = end {
+		end = start + width
+		if end > len(*A) {
+			end = len(*A)
+		}
+
+		qPos = cigar.writeRow(bw, qName, wName, wPos, Q, T, start, end, qPos, opt.Color)
+		bw.Write(padding)
+		bw.Write((*A)[start:end])
+		bw.WriteByte('\n')
+		tPos = cigar.writeRow(bw, tName, wName, wPos, T, Q, start, end, tPos, opt.Color)
+		bw.WriteByte('\n')
+	}
+
+	return bw.Flush()
+}
+
+// writeRow writes a row of a sequence, and returns the position of the last base.
+// S is the aligned sequence, and O is the other one.
+func (cigar *AlignmentResult) writeRow(bw *bufio.Writer, name string, wName int, wPos int,
+	S, O *[]byte, start, end int, pos int, color bool) int {
+	begin := pos + 1
+	for _, c := range (*S)[start:end] {
+		if c != '-' {
+			pos++
+		}
+	}
+	if pos < begin { // no bases in this row
+		begin = pos
+	}
+
+	fmt.Fprintf(bw, "%-*s %*d ", wName, name, wPos, begin)
+	if !color {
+		bw.Write((*S)[start:end])
+	} else {
+		for i := start; i < end; i++ {
+			if isAlignedColumn(S, O, i) && (*S)[i] != (*O)[i] {
+				bw.WriteString(colorMismatch)
+				bw.WriteByte((*S)[i])
+				bw.WriteString(colorReset)
+			} else {
+				bw.WriteByte((*S)[i])
+			}
+		}
+	}
+	fmt.Fprintf(bw, " %d\n", pos)
+	return pos
+}
+
+// isAlignedColumn tells whether the i-th column is a match or mismatch.
+func isAlignedColumn(Q, T *[]byte, i int) bool {
+	return (*Q)[i] != '-' && (*T)[i] != '-'
+}
+
+// isTransition tells whether two bases are a transition, i.e., A<->G or C<->T.
+func isTransition(a, b byte) bool {
+	a, b = a&0xDF, b&0xDF // to upper case
+	switch a {
+	case 'A':
+		return b == 'G'
+	case 'G':
+		return b == 'A'
+	case 'C':
+		return b == 'T' || b == 'U'
+	case 'T', 'U':
+		return b == 'C'
+	}
+	return false
+}
+
+func percentage(a, b uint32) float64 {
+	if b == 0 {
+		return 0
+	}
+	return float64(a) / float64(b) * 100
+}
@@ -0,0 +1,207 @@
+// Copyright © 2024 Wei Shen <shenwei356@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package wfa
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+)
+
+// Graph is a bidirected sequence graph of segments, loaded from a GFA v1 file.
+// Each segment has two handles, 2*i for the forward strand of the i-th segment,
+// and 2*i+1 for the reverse complement strand.
+//
+// It is experimental, only segments and links without overlaps are supported,
+// and other records like paths are ignored.
+type Graph struct {
+	Names []string // names of segments
+
+	seqs  [][]byte // sequences of handles
+	succ  [][]int  // successors of handles
+	index map[string]int
+}
+
+// ErrInvalidGFA means the GFA data is invalid or not supported.
+var ErrInvalidGFA error = fmt.Errorf("wfa: invalid or unsupported GFA data")
+
+// ReadGFA loads a graph from a local GFA v1 file.
+func ReadGFA(file string) (*Graph, error) {
+	fh, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer fh.Close()
+	return ParseGFA(fh)
+}
+
+// ParseGFA parses a graph from GFA v1 data.
+func ParseGFA(r io.Reader) (*Graph, error) {
+	g := &Graph{
+		Names: make([]string, 0, 1024),
+		seqs:  make([][]byte, 0, 2048),
+		index: make(map[string]int, 1024),
+	}
+
+	type link struct {
+		from, to       string
+		fromRev, toRev bool
+	}
+	links := make([]link, 0, 1024)
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 1<<20), 1<<30)
+	var line []byte
+	var fields [][]byte
+	for scanner.Scan() {
+		line = bytes.TrimRight(scanner.Bytes(), "\r\n")
+		if len(line) < 2 || line[1] != '\t' {
+			continue
+		}
+		switch line[0] {
+		case 'S':
+			fields = bytes.Split(line, []byte{'\t'})
+			if len(fields) < 3 || len(fields[2]) == 0 || (len(fields[2]) == 1 && fields[2][0] == '*') {
+				return nil, ErrInvalidGFA
+			}
+			name := string(fields[1])
+			if _, ok := g.index[name]; ok {
+				return nil, fmt.Errorf("wfa: duplicated segment in GFA: %s", name)
+			}
+			g.index[name] = len(g.Names)
+			g.Names = append(g.Names, name)
+			seq := append([]byte{}, fields[2]...)
+			g.seqs = append(g.seqs, seq, revComp(seq))
+		case 'L':
+			fields = bytes.Split(line, []byte{'\t'})
+			if len(fields) < 6 || !isOrientation(fields[2]) || !isOrientation(fields[4]) {
+				return nil, ErrInvalidGFA
+			}
+			if o := string(fields[5]); o != "*" && o != "0M" {
+				return nil, fmt.Errorf("wfa: GFA links with overlaps are not supported: %s", o)
+			}
+			links = append(links, link{
+				from:    string(fields[1]),
+				fromRev: fields[2][0] == '-',
+				to:      string(fields[3]),
+				toRev:   fields[4][0] == '-',
+			})
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	g.succ = make([][]int, len(g.seqs))
+	var from, to int
+	var ok bool
+	for _, l := range links {
+		if from, ok = g.index[l.from]; !ok {
+			return nil, fmt.Errorf("wfa: segment in GFA link not found: %s", l.from)
+		}
+		if to, ok = g.index[l.to]; !ok {
+			return nil, fmt.Errorf("wfa: segment in GFA link not found: %s", l.to)
+		}
+		from, to = from<<1, to<<1
+		if l.fromRev {
+			from |= 1
+		}
+		if l.toRev {
+			to |= 1
+		}
+		g.succ[from] = append(g.succ[from], to)
+		if from != to^1 { // the link of the reverse complement strands, except for a hairpin
+			g.succ[to^1] = append(g.succ[to^1], from^1)
+		}
+	}
+	return g, nil
+}
+
+func isOrientation(s []byte) bool {
+	return len(s) == 1 && (s[0] == '+' || s[0] == '-')
+}
+
+// NumSegments returns the number of segments.
+func (g *Graph) NumSegments() int {
+	return len(g.Names)
+}
+
+// Handle returns the handle of a segment, ok is false if the segment does not exist.
+func (g *Graph) Handle(name string, reverse bool) (int, bool) {
+	i, ok := g.index[name]
+	if !ok {
+		return 0, false
+	}
+	if reverse {
+		return i<<1 | 1, true
+	}
+	return i << 1, true
+}
+
+// HandleName returns the name of a handle in GAF style, e.g., ">s1" and "<s1".
+func (g *Graph) HandleName(h int) string {
+	if h&1 > 0 {
+		return "<" + g.Names[h>>1]
+	}
+	return ">" + g.Names[h>>1]
+}
+
+// Seq returns the sequence of a handle.
+func (g *Graph) Seq(h int) []byte {
+	return g.seqs[h]
+}
+
+// PathSeq returns the concatenated sequence of a path of handles.
+func (g *Graph) PathSeq(path []int) []byte {
+	var n int
+	for _, h := range path {
+		n += len(g.seqs[h])
+	}
+	s := make([]byte, 0, n)
+	for _, h := range path {
+		s = append(s, g.seqs[h]...)
+	}
+	return s
+}
+
+// complement of bases, others are converted to N.
+var complement [256]byte
+
+func init() {
+	for i := range complement {
+		complement[i] = 'N'
+	}
+	for _, p := range []string{"AT", "CG", "RY", "KM", "BV", "DH", "SS", "WW", "NN"} {
+		complement[p[0]], complement[p[1]] = p[1], p[0]
+		complement[p[0]+32], complement[p[1]+32] = p[1]+32, p[0]+32
+	}
+}
+
+// revComp returns the reverse complement sequence.
+func revComp(s []byte) []byte {
+	rc := make([]byte, len(s))
+	for i, b := range s {
+		rc[len(s)-1-i] = complement[b]
+	}
+	return rc
+}
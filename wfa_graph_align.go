@@ -0,0 +1,640 @@
+// Copyright © 2024 Wei Shen <shenwei356@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package wfa
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+)
+
+// GraphAlignment is the alignment of a query to a path of a graph.
+// The query is aligned end to end, while the alignment might start and end
+// inside the first and last segments of the path.
+type GraphAlignment struct {
+	Path      []int // handles of the path
+	PathLen   int   // total length of segments in the path
+	PathStart int   // 0-based start position on the path
+	PathEnd   int   // 0-based end position on the path, exclusive
+
+	// the alignment of the query and the path sequence from PathStart to PathEnd.
+	// Do not forget to recycle it.
+	*AlignmentResult
+}
+
+// ErrNoAnchor means no anchors are found between the query and the graph.
+var ErrNoAnchor error = fmt.Errorf("wfa: no anchors found between the query and the graph")
+
+// AlignGraph aligns a query to a path of a graph.
+// An anchor is found with minimizers of the query and segments with opt (DefaultSeedOptions if nil),
+// and wavefronts are extended from it in both directions, across segment boundaries.
+// Only the basic penalties of the aligner are used.
+//
+// It is experimental and does not use adaptive reduction,
+// so it is only suitable for small graphs and queries.
+func (algn *Aligner) AlignGraph(g *Graph, q []byte, opt *SeedOptions) (*GraphAlignment, error) {
+	if len(q) == 0 {
+		return nil, ErrEmptySeq
+	}
+	if opt == nil {
+		opt = DefaultSeedOptions
+	}
+	h0, a, err := g.anchor(q, opt)
+	if err != nil {
+		return nil, err
+	}
+
+	// forward extension from the anchor
+	gw := newGraphWFA(algn.p, g, q[a.Q:])
+	score := gw.align(h0, a.T)
+	path, start, end := gw.backtrace()
+	cigar := gw.cigar
+
+	ga := &GraphAlignment{}
+	if a.Q > 0 { // backward extension, i.e., the reverse complement query prefix on the reverse complement strands
+		L := len(g.seqs[h0])
+		gb := newGraphWFA(algn.p, g, revComp(q[:a.Q]))
+		score += gb.align(h0^1, L-a.T)
+		pathB, _, endB := gb.backtrace()
+		cigarB := gb.cigar
+		cigarB.Reverse()
+
+		for i := len(pathB) - 1; i > 0; i-- { // pathB[0] is the anchor segment
+			ga.Path = append(ga.Path, pathB[i]^1)
+		}
+		ga.PathStart = len(g.seqs[pathB[len(pathB)-1]]) - endB
+
+		cigarB.appendOps(cigar.Ops...)
+		RecycleAlignmentResult(cigar)
+		cigar = cigarB
+	} else {
+		ga.PathStart = start
+	}
+	ga.Path = append(ga.Path, path...)
+
+	for i, h := range ga.Path {
+		if i == len(ga.Path)-1 {
+			ga.PathEnd = ga.PathLen + end
+		}
+		ga.PathLen += len(g.seqs[h])
+	}
+	cigar.proccessed = true
+	cigar.count()
+	cigar.locate()
+	cigar.Score = score
+	ga.AlignmentResult = cigar
+	return ga, nil
+}
+
+// anchor finds the anchor with the most minimizer hits on the same diagonal of a handle,
+// and extends it to a maximal exact match.
+func (g *Graph) anchor(q []byte, opt *SeedOptions) (int, Anchor, error) {
+	if opt.K < 1 || opt.K > 32 || opt.W < 1 {
+		return 0, Anchor{}, ErrInvalidSeedOptions
+	}
+
+	qIdx := make(map[uint64]int, len(q)/opt.W*2)
+	minimizers(q, opt.K, opt.W, func(pos int, code uint64) {
+		if _, ok := qIdx[code]; ok {
+			qIdx[code] = -1
+		} else {
+			qIdx[code] = pos
+		}
+	})
+
+	type diagonal struct{ h, d int }
+	votes := make(map[diagonal]int, 1024)
+	firsts := make(map[diagonal]Anchor, 1024)
+	var best diagonal
+	found := false
+	for h, seq := range g.seqs {
+		minimizers(seq, opt.K, opt.W, func(pos int, code uint64) {
+			v, ok := qIdx[code]
+			if !ok || v < 0 {
+				return
+			}
+			d := diagonal{h, pos - v}
+			votes[d]++
+			if _, ok = firsts[d]; !ok {
+				firsts[d] = Anchor{Q: v, T: pos, Len: opt.K}
+			}
+			if !found || votes[d] > votes[best] {
+				best, found = d, true
+			}
+		})
+	}
+	if !found {
+		return 0, Anchor{}, ErrNoAnchor
+	}
+
+	a := firsts[best]
+	seq := g.seqs[best.h]
+	for a.Q > 0 && a.T > 0 && q[a.Q-1] == seq[a.T-1] {
+		a.Q--
+		a.T--
+		a.Len++
+	}
+	for a.Q+a.Len < len(q) && a.T+a.Len < len(seq) && q[a.Q+a.Len] == seq[a.T+a.Len] {
+		a.Len++
+	}
+	return best.h, a, nil
+}
+
+// components of graph wavefronts.
+const (
+	gwfaM = iota
+	gwfaI
+	gwfaD
+)
+
+// extra backtrace types of graph wavefronts.
+const (
+	gwfaStart uint32 = wfaMatch // the start position
+	gwfaPred  uint32 = 7        // transferred from the end of a predecessor
+)
+
+// graphNode contains the wavefronts of a handle, where diagonals are computed
+// with positions in the segment (h) and the query (v), i.e., k = h - v.
+type graphNode struct {
+	handle int
+	seq    []byte
+	s0     uint32         // the score when the node is reached
+	wfs    [3][]WaveFront // wavefronts of M, I, D for scores from s0
+}
+
+// wavefront returns the wavefront of a component for a score, or the empty one.
+func (nd *graphNode) wavefront(c int, s uint32) *WaveFront {
+	if s < nd.s0 || int(s-nd.s0) >= len(nd.wfs[c]) {
+		return &emptyWaveFront
+	}
+	return &nd.wfs[c][s-nd.s0]
+}
+
+// reserve makes sure wavefronts of all components exist for a score.
+func (nd *graphNode) reserve(s uint32) {
+	for c := range nd.wfs {
+		for len(nd.wfs[c]) <= int(s-nd.s0) {
+			nd.wfs[c] = append(nd.wfs[c], WaveFront{Lo: math.MaxInt, Hi: math.MinInt})
+		}
+	}
+}
+
+// graphCell is a cell of a component of a node.
+type graphCell struct {
+	handle int
+	c      int
+	s      uint32
+	k      int
+}
+
+// graphWFA aligns a query to a graph from a given position,
+// the query is aligned end to end, while the end position in the graph is free,
+// unless sink is not negative, where the alignment has to end at the sink node.
+type graphWFA struct {
+	p    *Penalties
+	g    *Graph
+	q    []byte
+	sink int
+
+	// optional reduction, cells of which the distance to the end is much longer
+	// than the best one are removed, like adaptive reduction.
+	remain      []int // estimated numbers of remaining bases in the graph from the start of handles
+	maxDistDiff int
+
+	nodes []*graphNode      // nodes of handles, nil for unreached ones
+	list  []*graphNode      // reached nodes
+	preds map[graphCell]int // predecessors of transferred cells
+	stack []graphCell
+
+	o0       int // start offset in the first node
+	endNode  *graphNode
+	endK     int
+	endScore uint32
+
+	cigar *AlignmentResult
+}
+
+func newGraphWFA(p *Penalties, g *Graph, q []byte) *graphWFA {
+	return &graphWFA{
+		p:     p,
+		g:     g,
+		q:     q,
+		sink:  -1,
+		nodes: make([]*graphNode, len(g.seqs)),
+		list:  make([]*graphNode, 0, 64),
+		preds: make(map[graphCell]int, 64),
+	}
+}
+
+// node returns the node of a handle, a new one is created if it is not reached yet.
+func (gw *graphWFA) node(h int, s uint32) *graphNode {
+	nd := gw.nodes[h]
+	if nd == nil {
+		nd = &graphNode{handle: h, seq: gw.g.seqs[h], s0: s}
+		gw.nodes[h] = nd
+		gw.list = append(gw.list, nd)
+	}
+	nd.reserve(s)
+	return nd
+}
+
+// align computes wavefronts from a start position, and returns the score.
+func (gw *graphWFA) align(h0 int, o0 int) uint32 {
+	gw.o0 = o0
+	nd := gw.node(h0, 0)
+	nd.wfs[gwfaM][0].Set(o0, uint32(o0), gwfaStart)
+
+	var lo, hi, k, i int
+	var wf *WaveFront
+	for s := uint32(0); ; s++ {
+		if s > 0 {
+			for _, nd = range gw.list {
+				gw.next(nd, s)
+			}
+		}
+
+		for i = 0; i < len(gw.list); i++ { // new nodes might be added in extension
+			nd = gw.list[i]
+			wf = nd.wavefront(gwfaM, s)
+			lo, hi = wf.Lo, wf.Hi
+			for k = lo; k <= hi; k++ {
+				if _, _, ok := nd.wavefront(gwfaM, s).Get(k); ok {
+					gw.extend(nd, s, k)
+				}
+			}
+
+			wf = nd.wavefront(gwfaI, s)
+			for k = wf.Lo; k <= wf.Hi; k++ {
+				if offset, _, ok := wf.Get(k); ok && int(offset) == len(nd.seq) {
+					gw.transfer(nd, gwfaI, s, int(offset)-k)
+				}
+			}
+		}
+
+		if gw.endNode != nil {
+			gw.endScore = s
+			return s
+		}
+		if gw.remain != nil {
+			gw.reduce(s)
+		}
+	}
+}
+
+// reduce removes cells of a score, of which the distance to the end is
+// longer than the shortest one by more than maxDistDiff.
+// Cells of all components on a diagonal are removed together according to the one in M,
+// and cells at the end of nodes with successors are kept for backtrace, as they are not extended anymore.
+func (gw *graphWFA) reduce(s uint32) {
+	n := len(gw.q)
+	dist := func(nd *graphNode, offset uint32, k int) int {
+		h := int(offset)
+		return gw.remain[nd.handle] - h + n - (h - k)
+	}
+
+	best := math.MaxInt
+	var wf *WaveFront
+	var k int
+	for _, nd := range gw.list {
+		wf = nd.wavefront(gwfaM, s)
+		for k = wf.Lo; k <= wf.Hi; k++ {
+			if offset, _, ok := wf.Get(k); ok {
+				best = min(best, dist(nd, offset, k))
+			}
+		}
+	}
+	if best == math.MaxInt {
+		return
+	}
+
+	threshold := best + gw.maxDistDiff
+	for _, nd := range gw.list {
+		wf = nd.wavefront(gwfaM, s)
+		L, hasSucc := len(nd.seq), len(gw.g.succ[nd.handle]) > 0
+		for k = wf.Lo; k <= wf.Hi; k++ {
+			offset, _, ok := wf.Get(k)
+			if !ok || hasSucc && int(offset) == L || dist(nd, offset, k) <= threshold {
+				continue
+			}
+			wf.Delete(k)
+			nd.wavefront(gwfaI, s).Delete(k)
+			nd.wavefront(gwfaD, s).Delete(k)
+		}
+	}
+}
+
+// next computes the wavefronts of a node for a score.
+func (gw *graphWFA) next(nd *graphNode, s uint32) {
+	p := gw.p
+	x, oe, e := p.Mismatch, p.GapOpen+p.GapExt, p.GapExt
+
+	wfX := nd.wavefront(gwfaM, s-x)
+	if x > s {
+		wfX = &emptyWaveFront
+	}
+	wfO := nd.wavefront(gwfaM, s-oe)
+	if oe > s {
+		wfO = &emptyWaveFront
+	}
+	wfI := nd.wavefront(gwfaI, s-e)
+	wfD := nd.wavefront(gwfaD, s-e)
+	if e > s {
+		wfI, wfD = &emptyWaveFront, &emptyWaveFront
+	}
+
+	lo, hi := math.MaxInt, math.MinInt
+	for _, r := range [][3]int{{wfX.Lo, wfX.Hi, 0}, {wfO.Lo, wfO.Hi, 1}, {wfI.Lo, wfI.Hi, 2}, {wfD.Lo, wfD.Hi, 3}} {
+		if r[0] > r[1] {
+			continue
+		}
+		switch r[2] {
+		case 1: // gap opening, k-1 and k+1
+			lo, hi = min(lo, r[0]-1), max(hi, r[1]+1)
+		case 2: // insertion, k-1
+			lo, hi = min(lo, r[0]+1), max(hi, r[1]+1)
+		case 3: // deletion, k+1
+			lo, hi = min(lo, r[0]-1), max(hi, r[1]-1)
+		default:
+			lo, hi = min(lo, r[0]), max(hi, r[1])
+		}
+	}
+	if lo > hi {
+		return
+	}
+
+	nd.reserve(s)
+	M := &nd.wfs[gwfaM][s-nd.s0]
+	I := &nd.wfs[gwfaI][s-nd.s0]
+	D := &nd.wfs[gwfaD][s-nd.s0]
+	L, n := len(nd.seq), len(gw.q)
+	// cells at the end of a node with successors do not need deletions,
+	// which are computed in the successors after transferring.
+	hasSucc := len(gw.g.succ[nd.handle]) > 0
+
+	var h, hI, hD, hM int
+	var tI, tD, tM uint32
+	var offset uint32
+	var ok bool
+	for k := lo; k <= hi; k++ {
+		// I: one more base of the segment
+		hI, tI = -1, 0
+		if offset, _, ok = wfO.Get(k - 1); ok {
+			hI, tI = int(offset)+1, wfaInsertOpen
+		}
+		if offset, _, ok = wfI.Get(k - 1); ok && int(offset)+1 > hI {
+			hI, tI = int(offset)+1, wfaInsertExt
+		}
+		if hI > L {
+			hI = -1
+		}
+
+		// D: one more base of the query
+		hD, tD = -1, 0
+		if offset, _, ok = wfO.Get(k + 1); ok {
+			hD, tD = int(offset), wfaDeleteOpen
+		}
+		if offset, _, ok = wfD.Get(k + 1); ok && int(offset) > hD {
+			hD, tD = int(offset), wfaDeleteExt
+		}
+		if hD >= 0 && (hD-k > n || hasSucc && hD == L) {
+			hD = -1
+		}
+
+		// M: a mismatch, or from I and D
+		hM, tM = -1, 0
+		if offset, _, ok = wfX.Get(k); ok {
+			h = int(offset) + 1
+			if h <= L && h-k <= n {
+				hM, tM = h, wfaMismatch
+			}
+		}
+		if hI >= 0 {
+			I.Set(k, uint32(hI), tI)
+			if hI > hM {
+				hM, tM = hI, wfaInsertOpen
+			}
+		}
+		if hD >= 0 {
+			D.Set(k, uint32(hD), tD)
+			if hD > hM {
+				hM, tM = hD, wfaDeleteOpen
+			}
+		}
+		if hM >= 0 {
+			M.Set(k, uint32(hM), tM)
+		}
+	}
+}
+
+// extend extends matches of a cell in M, and transfers cells reaching the end of the segment
+// to successors, which are also extended.
+func (gw *graphWFA) extend(nd *graphNode, s uint32, k int) {
+	gw.stack = append(gw.stack[:0], graphCell{handle: nd.handle, s: s, k: k})
+	var c graphCell
+	var offset uint32
+	var h, v, h0, L int
+	n := len(gw.q)
+	for len(gw.stack) > 0 {
+		c = gw.stack[len(gw.stack)-1]
+		gw.stack = gw.stack[:len(gw.stack)-1]
+
+		nd = gw.nodes[c.handle]
+		wf := nd.wavefront(gwfaM, s)
+		offset, _, _ = wf.Get(c.k)
+		h = int(offset)
+		v = h - c.k
+		h0, L = h, len(nd.seq)
+		for h < L && v < n && nd.seq[h] == gw.q[v] {
+			h++
+			v++
+		}
+		if h > h0 {
+			wf.Increase(c.k, uint32(h-h0))
+		}
+
+		if v == n && gw.endNode == nil && (gw.sink < 0 || nd.handle == gw.sink) {
+			gw.endNode, gw.endK = nd, c.k
+		}
+		if h == L {
+			gw.transfer(nd, gwfaM, s, v)
+		}
+	}
+}
+
+// transfer transfers a cell at the end of a segment to the beginning of successors.
+// v is the number of aligned query bases.
+func (gw *graphWFA) transfer(nd *graphNode, c int, s uint32, v int) {
+	k := -v
+	for _, h := range gw.g.succ[nd.handle] {
+		next := gw.node(h, s)
+		wf := &next.wfs[c][s-next.s0]
+		if _, t, ok := wf.Get(k); ok {
+			// choosing the predecessor with the smallest handle for ties,
+			// so that reads follow the oldest path in partial-order alignment.
+			if t == gwfaPred {
+				cell := graphCell{handle: h, c: c, s: s, k: k}
+				if nd.handle < gw.preds[cell] {
+					gw.preds[cell] = nd.handle
+				}
+			}
+			continue
+		}
+		wf.Set(k, 0, gwfaPred)
+		gw.preds[graphCell{handle: h, c: c, s: s, k: k}] = nd.handle
+		if c == gwfaM {
+			gw.stack = append(gw.stack, graphCell{handle: h, s: s, k: k})
+		}
+	}
+}
+
+// backtrace computes the operations, and returns the path,
+// the start offset in the first node, and the end offset in the last node.
+func (gw *graphWFA) backtrace() ([]int, int, int) {
+	p := gw.p
+	cigar := NewAlignmentResult(true)
+	path := make([]int, 0, 8)
+
+	nd, s, k, c := gw.endNode, gw.endScore, gw.endK, gwfaM
+	offset, _, _ := nd.wavefront(gwfaM, s).Get(k)
+	h := int(offset)
+	end := h
+	path = append(path, nd.handle)
+
+	var t, src uint32
+	var h0 int
+	for {
+		_, t, _ = nd.wavefront(c, s).Get(k)
+		if t == gwfaPred { // jump to the end of the predecessor
+			if h > 0 { // matches in M
+				cigar.AddN('M', uint32(h))
+			}
+			nd = gw.nodes[gw.preds[graphCell{handle: nd.handle, c: c, s: s, k: k}]]
+			path = append(path, nd.handle)
+			k = len(nd.seq) + k // v = -k
+			h = len(nd.seq)
+			continue
+		}
+
+		switch c {
+		case gwfaM:
+			switch t {
+			case wfaMismatch:
+				src, _, _ = nd.wavefront(gwfaM, s-p.Mismatch).Get(k)
+				h0 = int(src) + 1
+			case wfaInsertOpen:
+				src, _, _ = nd.wavefront(gwfaI, s).Get(k)
+				h0 = int(src)
+			case wfaDeleteOpen:
+				src, _, _ = nd.wavefront(gwfaD, s).Get(k)
+				h0 = int(src)
+			default: // start
+				h0 = gw.o0
+			}
+			if h > h0 {
+				cigar.AddN('M', uint32(h-h0))
+			}
+			h = h0
+
+			switch t {
+			case wfaMismatch:
+				cigar.AddN('X', 1)
+				s -= p.Mismatch
+				h--
+			case wfaInsertOpen:
+				c = gwfaI
+			case wfaDeleteOpen:
+				c = gwfaD
+			default:
+				for i, j := 0, len(path)-1; i < j; i, j = i+1, j-1 {
+					path[i], path[j] = path[j], path[i]
+				}
+				if len(cigar.Ops) > 0 {
+					cigar.process()
+				} else {
+					cigar.proccessed = true
+				}
+				gw.cigar = cigar
+				return path, gw.o0, end
+			}
+		case gwfaI:
+			cigar.AddN('I', 1)
+			if t == wfaInsertOpen {
+				s -= p.GapOpen + p.GapExt
+				c = gwfaM
+			} else {
+				s -= p.GapExt
+			}
+			k--
+			h--
+		default:
+			cigar.AddN('D', 1)
+			if t == wfaDeleteOpen {
+				s -= p.GapOpen + p.GapExt
+				c = gwfaM
+			} else {
+				s -= p.GapExt
+			}
+			k++
+		}
+	}
+}
+
+// WriteGAF writes a graph alignment as a GAF record, the strand is always "+",
+// as the orientation is stored in the path.
+// The CIGAR in the "cg" tag follows the SAM convention, where "I" means bases only in the query,
+// and "D" means bases only in the graph, i.e., "D" and "I" of AlignmentResult, respectively.
+func (g *Graph) WriteGAF(w io.Writer, qname string, qlen int, ga *GraphAlignment) error {
+	ga.process()
+	bw := bufio.NewWriter(w)
+
+	var blockLen, nm, n uint32
+	for _, op := range ga.Ops {
+		n = uint32(op & MaskLower32)
+		blockLen += n
+		if op>>32 != OpM {
+			nm += n
+		}
+	}
+
+	fmt.Fprintf(bw, "%s\t%d\t%d\t%d\t+\t", qname, qlen, 0, qlen)
+	for _, h := range ga.Path {
+		bw.WriteString(g.HandleName(h))
+	}
+	fmt.Fprintf(bw, "\t%d\t%d\t%d\t%d\t%d\t255\tNM:i:%d\tcg:Z:",
+		ga.PathLen, ga.PathStart, ga.PathEnd, ga.Matches, blockLen, nm)
+	for _, op := range ga.Ops {
+		bw.WriteString(strconv.Itoa(int(op & MaskLower32)))
+		switch op >> 32 {
+		case OpM:
+			bw.WriteByte('=')
+		case OpI:
+			bw.WriteByte('D')
+		case OpD:
+			bw.WriteByte('I')
+		default:
+			bw.WriteByte(byte(op >> 32))
+		}
+	}
+	bw.WriteByte('\n')
+	return bw.Flush()
+}
@@ -0,0 +1,195 @@
+// Copyright © 2024 Wei Shen <shenwei356@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package wfa
+
+import "sort"
+
+// PosType is the alignment state of a mapped position.
+type PosType uint8
+
+const (
+	PosOutOfRange PosType = iota // out of the sequence range
+	PosClipped                   // in the flanking regions which are not aligned
+	PosMatch                     // aligned to an identical base
+	PosMismatch                  // aligned to a different base
+	PosGap                       // aligned to a gap
+)
+
+func (pt PosType) String() string {
+	switch pt {
+	case PosClipped:
+		return "clipped"
+	case PosMatch:
+		return "match"
+	case PosMismatch:
+		return "mismatch"
+	case PosGap:
+		return "gap"
+	default:
+		return "out-of-range"
+	}
+}
+
+// QueryToTarget maps a 1-based query position to the target.
+// For a position aligned to a gap, the position of the target base before the gap is returned,
+// which is 0 if the gap is at the beginning.
+// For positions in flanking regions or out of range, 0 is returned.
+//
+// A cumulative index of operations is built in the first call,
+// so following calls only take O(log n) time.
+func (cigar *AlignmentResult) QueryToTarget(pos int) (int, PosType) {
+	return cigar.mapPos(pos, true)
+}
+
+// TargetToQuery maps a 1-based target position to the query.
+// The rules are the same as QueryToTarget.
+func (cigar *AlignmentResult) TargetToQuery(pos int) (int, PosType) {
+	return cigar.mapPos(pos, false)
+}
+
+// QueryIntervalToTarget maps a 1-based query interval [start, end] to the target.
+// The returned interval covers the target bases aligned to the interval (matches and mismatches).
+// ok is false if none of the bases in the interval are aligned.
+func (cigar *AlignmentResult) QueryIntervalToTarget(start, end int) (int, int, bool) {
+	return cigar.mapInterval(start, end, true)
+}
+
+// TargetIntervalToQuery maps a 1-based target interval [start, end] to the query.
+// The rules are the same as QueryIntervalToTarget.
+func (cigar *AlignmentResult) TargetIntervalToQuery(start, end int) (int, int, bool) {
+	return cigar.mapInterval(start, end, false)
+}
+
+// index builds the cumulative index of operations.
+func (cigar *AlignmentResult) index() {
+	cigar.process()
+	if cigar.indexed {
+		return
+	}
+
+	qEnds, tEnds := cigar.qEnds[:0], cigar.tEnds[:0]
+	var v, h, n int
+	begin, end := len(cigar.Ops), -1
+	for i, op := range cigar.Ops {
+		n = int(op & MaskLower32)
+		switch op >> 32 {
+		case OpM, OpX:
+			v += n
+			h += n
+			if i < begin {
+				begin = i
+			}
+			end = i
+		case OpI:
+			h += n
+		case OpD, OpH:
+			v += n
+		}
+		qEnds = append(qEnds, v)
+		tEnds = append(tEnds, h)
+	}
+	if cigar.globalAlignment {
+		begin, end = 0, len(cigar.Ops)-1
+	}
+
+	cigar.qEnds, cigar.tEnds = qEnds, tEnds
+	cigar.opBegin, cigar.opEnd = begin, end
+	cigar.indexed = true
+}
+
+// mapPos maps a 1-based position from the query to the target, or the reverse.
+func (cigar *AlignmentResult) mapPos(pos int, fromQuery bool) (int, PosType) {
+	cigar.index()
+	src, dst := cigar.qEnds, cigar.tEnds
+	if !fromQuery {
+		src, dst = dst, src
+	}
+	if len(src) == 0 || pos < 1 || pos > src[len(src)-1] {
+		return 0, PosOutOfRange
+	}
+
+	// the first operation containing the position.
+	i := sort.SearchInts(src, pos)
+	if i < cigar.opBegin || i > cigar.opEnd {
+		return 0, PosClipped
+	}
+
+	switch cigar.Ops[i] >> 32 {
+	case OpM:
+		return dst[i] - (src[i] - pos), PosMatch
+	case OpX:
+		return dst[i] - (src[i] - pos), PosMismatch
+	case OpH:
+		return 0, PosClipped
+	default: // gaps do not consume bases of the other sequence.
+		return dst[i], PosGap
+	}
+}
+
+// mapInterval maps a 1-based interval from the query to the target, or the reverse.
+func (cigar *AlignmentResult) mapInterval(start, end int, fromQuery bool) (int, int, bool) {
+	cigar.index()
+	src, dst := cigar.qEnds, cigar.tEnds
+	if !fromQuery {
+		src, dst = dst, src
+	}
+	if len(src) == 0 {
+		return 0, 0, false
+	}
+	if start < 1 {
+		start = 1
+	}
+	if end > src[len(src)-1] {
+		end = src[len(src)-1]
+	}
+	if start > end {
+		return 0, 0, false
+	}
+	ops := cigar.Ops
+
+	// the first aligned base
+	i := sort.SearchInts(src, start)
+	for i < len(ops) && !isMatchOrMismatch(ops[i]) {
+		i++
+	}
+	if i == len(ops) {
+		return 0, 0, false
+	}
+	s := src[i] - int(ops[i]&MaskLower32) + 1
+	if s < start {
+		s = start
+	}
+	if s > end {
+		return 0, 0, false
+	}
+
+	// the last aligned base
+	j := sort.SearchInts(src, end)
+	for !isMatchOrMismatch(ops[j]) {
+		j--
+	}
+	e := src[j]
+	if e > end {
+		e = end
+	}
+
+	return dst[i] - (src[i] - s), dst[j] - (src[j] - e), true
+}
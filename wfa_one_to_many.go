@@ -0,0 +1,144 @@
+// Copyright © 2024 Wei Shen <shenwei356@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package wfa
+
+import (
+	"math"
+	"sort"
+)
+
+// OneToManyOptions contains the options for AlignOneToMany().
+type OneToManyOptions struct {
+	AllHits bool // Return all hits sorted by score, instead of only the best one.
+
+	// Only report hits with alignment scores <= MaxScore, a negative value for no limit.
+	// In searching the best hit, the alignment of a target stops early
+	// once its score exceeds the best one found so far.
+	MaxScore int
+
+	IgnoreCase bool // Ignore the case of bases.
+}
+
+// DefaultOneToManyOptions returns the best hit with no score limit.
+var DefaultOneToManyOptions = &OneToManyOptions{
+	MaxScore: -1,
+}
+
+// Hit is the alignment result of a target in AlignOneToMany().
+type Hit struct {
+	Target int // Index of the target
+	*AlignmentResult
+}
+
+// AlignOneToMany aligns a query against many targets, e.g., primers or barcodes,
+// and returns the best hit (the first one for ties) or all hits sorted by score.
+// The returned slice is empty if no hits have scores <= opt.MaxScore.
+// opt could be nil for DefaultOneToManyOptions.
+// Do not forget to recycle the results of hits with RecycleAlignmentResult().
+func (algn *Aligner) AlignOneToMany(q []byte, targets [][]byte, opt *OneToManyOptions) ([]Hit, error) {
+	if opt == nil {
+		opt = DefaultOneToManyOptions
+	}
+	if len(q) == 0 {
+		return nil, ErrEmptySeq
+	}
+
+	var maxScore uint32 = math.MaxUint32
+	if opt.MaxScore >= 0 {
+		maxScore = uint32(opt.MaxScore)
+	}
+	defer func() { algn.maxScore = math.MaxUint32 }()
+
+	// the query is only processed once.
+	var buf, bufT *[]byte
+	if opt.IgnoreCase {
+		buf = poolBytes.Get().(*[]byte)
+		bufT = poolBytes.Get().(*[]byte)
+		*buf = toUpper((*buf)[:0], q)
+		q = *buf
+		defer func() {
+			*buf = (*buf)[:0]
+			poolBytes.Put(buf)
+			*bufT = (*bufT)[:0]
+			poolBytes.Put(bufT)
+		}()
+	}
+
+	hits := make([]Hit, 0, 1)
+	var t []byte
+	var result *AlignmentResult
+	var err error
+	for i := range targets {
+		t = targets[i]
+		if opt.IgnoreCase {
+			*bufT = toUpper((*bufT)[:0], t)
+			t = *bufT
+		}
+
+		algn.maxScore = maxScore
+		result, err = algn.align(algn.bytes(&q, &t))
+		if err == errScoreExceeded {
+			continue
+		}
+		if err != nil {
+			for _, hit := range hits {
+				RecycleAlignmentResult(hit.AlignmentResult)
+			}
+			return nil, err
+		}
+
+		if opt.AllHits {
+			hits = append(hits, Hit{Target: i, AlignmentResult: result})
+			continue
+		}
+
+		// the best hit. the score of this one must be <= maxScore
+		if len(hits) == 0 {
+			hits = append(hits, Hit{Target: i, AlignmentResult: result})
+		} else if result.Score < hits[0].Score {
+			RecycleAlignmentResult(hits[0].AlignmentResult)
+			hits[0] = Hit{Target: i, AlignmentResult: result}
+		} else {
+			RecycleAlignmentResult(result)
+			continue
+		}
+		if hits[0].Score == 0 { // can not be better
+			break
+		}
+		maxScore = hits[0].Score - 1 // following targets need better scores
+	}
+
+	if opt.AllHits {
+		sort.SliceStable(hits, func(i, j int) bool { return hits[i].Score < hits[j].Score })
+	}
+	return hits, nil
+}
+
+// toUpper appends the upper case of s to dst.
+func toUpper(dst, s []byte) []byte {
+	for _, b := range s {
+		if 'a' <= b && b <= 'z' {
+			b -= 'a' - 'A'
+		}
+		dst = append(dst, b)
+	}
+	return dst
+}
@@ -0,0 +1,252 @@
+// Copyright © 2024 Wei Shen <shenwei356@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package wfa
+
+import "math/bits"
+
+// PackedSeq is a DNA sequence packed with 2 bits per base (A: 0, C: 1, G: 2, T/U: 3, case-insensitive),
+// which takes a quarter of the memory of a byte slice, e.g., for keeping many long sequences in memory.
+// Other bases (e.g., N) are tracked in a separate 1-bit mask, which is only created when needed,
+// and they are all regarded as N, i.e., N matches N but no other bases.
+type PackedSeq struct {
+	n     int      // sequence length
+	words []uint64 // 32 bases per word, the i-th base is in the bits [2*(i%32), 2*(i%32)+2) of words[i/32].
+	mask  []uint64 // 64 bases per word, for bases other than ACGT. It's nil if there's no such bases.
+}
+
+// base2code maps a base to its 2-bit code, and 4 for other bases.
+var base2code [256]byte
+
+func init() {
+	for i := range base2code {
+		base2code[i] = 4
+	}
+	for i, b := range []byte("ACGT") {
+		base2code[b] = byte(i)
+		base2code[b|0x20] = byte(i) // lower case
+	}
+	base2code['U'], base2code['u'] = 3, 3
+}
+
+// NewPackedSeq packs a DNA sequence.
+func NewPackedSeq(s []byte) *PackedSeq {
+	p := &PackedSeq{}
+	p.Pack(s)
+	return p
+}
+
+// Pack packs a DNA sequence, reusing the memory of the object.
+func (p *PackedSeq) Pack(s []byte) {
+	p.n = len(s)
+
+	// one more word, so we can always read 64 bits from any position.
+	nw := len(s)>>5 + 2
+	if cap(p.words) >= nw {
+		p.words = p.words[:nw]
+		clear(p.words)
+	} else {
+		p.words = make([]uint64, nw)
+	}
+	p.mask = p.mask[:0]
+
+	var c byte
+	for i, b := range s {
+		c = base2code[b]
+		if c > 3 {
+			if len(p.mask) == 0 {
+				nm := len(s)>>6 + 2
+				if cap(p.mask) >= nm {
+					p.mask = p.mask[:nm]
+					clear(p.mask)
+				} else {
+					p.mask = make([]uint64, nm)
+				}
+			}
+			p.mask[i>>6] |= 1 << (i & 63)
+			continue // as A
+		}
+		p.words[i>>5] |= uint64(c) << ((i & 31) << 1)
+	}
+}
+
+// Len returns the sequence length.
+func (p *PackedSeq) Len() int { return p.n }
+
+// Base returns the base (in upper case) at a 0-based position.
+func (p *PackedSeq) Base(i int) byte {
+	if len(p.mask) > 0 && p.mask[i>>6]>>(i&63)&1 > 0 {
+		return 'N'
+	}
+	return "ACGT"[p.words[i>>5]>>((i&31)<<1)&3]
+}
+
+// Bytes unpacks the sequence.
+func (p *PackedSeq) Bytes() []byte {
+	s := make([]byte, p.n)
+	for i := range s {
+		s[i] = p.Base(i)
+	}
+	return s
+}
+
+// word32 returns the 32 bases starting from a 0-based position.
+func (p *PackedSeq) word32(i int) uint64 {
+	w, s := i>>5, uint(i&31)<<1
+	return p.words[w]>>s | p.words[w+1]<<(64-s) // x<<64 is 0 in Go
+}
+
+// mask32 returns the N mask of the 32 bases starting from a 0-based position.
+func (p *PackedSeq) mask32(i int) uint32 {
+	if len(p.mask) == 0 {
+		return 0
+	}
+	w, s := i>>6, uint(i&63)
+	return uint32(p.mask[w]>>s | p.mask[w+1]<<(64-s))
+}
+
+// equal tells whether the bases at i of p and j of o are identical.
+func (p *PackedSeq) equal(i int, o *PackedSeq, j int) bool {
+	return (p.word32(i)^o.word32(j))&3 == 0 && (p.mask32(i)^o.mask32(j))&1 == 0
+}
+
+// packedSeqs is a pair of packed sequences.
+type packedSeqs struct {
+	q, t *PackedSeq
+}
+
+func (s *packedSeqs) lens() (int, int) { return s.q.n, s.t.n }
+
+func (s *packedSeqs) equal(v, h int) bool { return s.q.equal(v, s.t, h) }
+
+func (s *packedSeqs) extend(v, h int) int {
+	q, t := s.q, s.t
+	hasMask := len(q.mask) > 0 || len(t.mask) > 0
+	var x uint64
+	var m uint32
+	var n, N, remain int
+	for {
+		remain = min(q.n-v, t.n-h)
+		if remain <= 0 {
+			return N
+		}
+
+		// compare every 32 bases, xor them and count trailing zeroes.
+		n = 32
+		if x = q.word32(v) ^ t.word32(h); x != 0 {
+			n = bits.TrailingZeros64(x) >> 1 // divide 2
+		}
+		if hasMask {
+			if m = q.mask32(v) ^ t.mask32(h); m != 0 {
+				n = min(n, bits.TrailingZeros32(m))
+			}
+		}
+
+		if n >= remain {
+			return N + remain
+		}
+		N += n
+		if n < 32 {
+			return N
+		}
+		v += 32
+		h += 32
+	}
+}
+
+// extendPacked is extend() for packed sequences, which works on the offsets of the wavefront
+// directly, and compares words without checking the N masks if there's no N bases.
+func (algn *Aligner) extendPacked(ps *packedSeqs, wf *WaveFront) {
+	qw, tw := ps.q.words, ps.t.words
+	lenQ, lenT := ps.q.n, ps.t.n
+	hasMask := len(ps.q.mask) > 0 || len(ps.t.mask) > 0
+	stats := algn.stats
+
+	offsets := wf.Offsets[wf.Lo-wf.base : wf.Hi-wf.base+1]
+	k0 := wf.Lo
+	var v, h, N int
+	for i, offset := range offsets {
+		if offset == 0 {
+			continue
+		}
+		h = int(offset >> wfaTypeBits)
+		v = h - k0 - i
+		if v <= 0 || v >= lenQ || h >= lenT { // bound check
+			continue
+		}
+
+		if hasMask {
+			N = ps.extend(v, h)
+		} else {
+			N = extendWords(qw, tw, v, h, min(lenQ-v, lenT-h))
+		}
+		if stats != nil { // the matched bases and a mismatched one
+			stats.BasesCompared += min(N+1, lenQ-v, lenT-h)
+		}
+		offsets[i] += uint32(N) << wfaTypeBits
+	}
+}
+
+// extendWords returns the number of identical bases of packed words from 0-based positions v and h,
+// up to remain bases.
+func extendWords(qw, tw []uint64, v, h, remain int) int {
+	var x uint64
+	var N int
+	for {
+		if x = word32(qw, v) ^ word32(tw, h); x != 0 {
+			return N + min(bits.TrailingZeros64(x)>>1, remain)
+		}
+		if remain <= 32 {
+			return N + remain
+		}
+		N += 32
+		v += 32
+		h += 32
+		remain -= 32
+	}
+}
+
+// word32 returns the 32 bases starting from a 0-based position of packed words.
+func word32(words []uint64, i int) uint64 {
+	w, s := i>>5, uint(i&31)<<1
+	if s == 0 { // aligned
+		return words[w]
+	}
+	return words[w]>>s | words[w+1]<<(64-s)
+}
+
+func (s *packedSeqs) markRepeats(query bool, rp *RepeatGapPenalties, marks []bool) bool {
+	p := s.t
+	if query {
+		p = s.q
+	}
+	markRepeats(p.n, func(i, j int) bool { return p.equal(i, p, j) }, rp, marks)
+	return true
+}
+
+// AlignPacked performs alignment with two packed DNA sequences, without unpacking them.
+// It compares 32 bases at a time in extension, so it is faster than Align() for similar sequences,
+// where extension takes a large part of the time, and comparable for divergent ones.
+// AlignmentResult.AlignmentText() and other methods needing sequences
+// can be called with the unpacked sequences from PackedSeq.Bytes().
+func (algn *Aligner) AlignPacked(q, t *PackedSeq) (*AlignmentResult, error) {
+	algn._packed.q, algn._packed.t = q, t
+	return algn.align(&algn._packed)
+}
@@ -0,0 +1,478 @@
+// Copyright © 2024 Wei Shen <shenwei356@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package wfa
+
+import (
+	"fmt"
+	"slices"
+)
+
+// QualityPenalties contains mismatch penalties for query bases of different Phred qualities.
+//
+//	quality <  Cutoffs[0]:                 Mismatches[0]
+//	Cutoffs[i-1] <= quality < Cutoffs[i]:  Mismatches[i]
+//	quality >= Cutoffs[len(Cutoffs)-1]:    Mismatches[len(Cutoffs)]
+type QualityPenalties struct {
+	Offset     byte     // ASCII offset of quality values, 33 for Sanger and Illumina 1.8+.
+	Cutoffs    []byte   // Phred quality cutoffs in ascending order.
+	Mismatches []uint32 // Mismatch penalties, one more than the cutoffs.
+}
+
+// DefaultQualityPenalties charges 2 for mismatches of bases with a quality < 20, and 6 for others.
+var DefaultQualityPenalties = &QualityPenalties{
+	Offset:     33,
+	Cutoffs:    []byte{20},
+	Mismatches: []uint32{2, 6},
+}
+
+// ErrInvalidQualityPenalties means the quality penalties are not valid.
+var ErrInvalidQualityPenalties error = fmt.Errorf("wfa: invalid quality penalties")
+
+// ErrQualityLen means the length of quality values differs from that of the query sequence.
+var ErrQualityLen error = fmt.Errorf("wfa: the quality and the query sequence should have the same length")
+
+// QualityPenalties sets the quality-aware mismatch penalties used in AlignWithQuality().
+func (algn *Aligner) QualityPenalties(qp *QualityPenalties) error {
+	if len(qp.Mismatches) != len(qp.Cutoffs)+1 {
+		return ErrInvalidQualityPenalties
+	}
+	for i, c := range qp.Cutoffs {
+		if i > 0 && c <= qp.Cutoffs[i-1] {
+			return ErrInvalidQualityPenalties
+		}
+	}
+	for _, x := range qp.Mismatches {
+		if x == 0 {
+			return ErrInvalidQualityPenalties
+		}
+	}
+	algn.qp = qp
+	return nil
+}
+
+// penalty returns the mismatch penalty of a quality value.
+func (qp *QualityPenalties) penalty(qual byte) uint32 {
+	var q byte
+	if qual > qp.Offset {
+		q = qual - qp.Offset
+	}
+	for i, c := range qp.Cutoffs {
+		if q < c {
+			return qp.Mismatches[i]
+		}
+	}
+	return qp.Mismatches[len(qp.Cutoffs)]
+}
+
+// posPenalties stores position-specific penalties of a sequence.
+type posPenalties struct {
+	diffs  []uint32 // all distinct penalties
+	values []uint32 // penalty of each position
+}
+
+// reset clears the data.
+func (pp *posPenalties) reset() {
+	pp.diffs = pp.diffs[:0]
+	pp.values = pp.values[:0]
+}
+
+// add appends the penalty of the next position.
+func (pp *posPenalties) add(x uint32) {
+	pp.values = append(pp.values, x)
+	if !slices.Contains(pp.diffs, x) {
+		pp.diffs = append(pp.diffs, x)
+	}
+}
+
+// at returns the penalty of a 0-based position.
+// Out-of-range positions are adjusted to the nearest ends.
+func (pp *posPenalties) at(i int) uint32 {
+	if i < 0 {
+		i = 0
+	} else if i >= len(pp.values) {
+		i = len(pp.values) - 1
+	}
+	return pp.values[i]
+}
+
+// kRange returns the union of k ranges of cpt[s-x] for all penalties x.
+// If pp is nil, the fixed penalty diff is used.
+func kRange(cpt *Component, s uint32, pp *posPenalties, diff uint32) (int, int) {
+	if pp == nil {
+		return cpt.KRange(s, diff)
+	}
+	var lo, hi, _lo, _hi int
+	for i, x := range pp.diffs {
+		_lo, _hi = cpt.KRange(s, x)
+		if i == 0 {
+			lo, hi = _lo, _hi
+			continue
+		}
+		lo, hi = min(lo, _lo), max(hi, _hi)
+	}
+	return lo, hi
+}
+
+// getPositional returns the largest offset of cpt[s-x][k] for all penalties x,
+// where x must be the penalty of the position the offset moves to.
+// shift converts an offset to the 0-based index of the position.
+// If pp is nil, it equals to cpt.GetAfterDiff(s, diff, k).
+func getPositional(cpt *Component, s uint32, k int, pp *posPenalties, diff uint32, shift int) (uint32, bool) {
+	if pp == nil {
+		offset, _, ok := cpt.GetAfterDiff(s, diff, k)
+		return offset, ok
+	}
+	var offset, best uint32
+	var ok, found bool
+	for _, x := range pp.diffs {
+		offset, _, ok = cpt.GetAfterDiff(s, x, k)
+		if !ok || pp.at(int(offset)+shift) != x {
+			continue
+		}
+		if !found || offset > best {
+			best, found = offset, true
+		}
+	}
+	return best, found
+}
+
+// RepeatGapPenalties contains gap-affine penalties for gaps in homopolymers or short tandem repeats,
+// which are the dominant error mode of long reads.
+// For an insertion, the inserted base in the target is checked, and a deletion checks the base in the query.
+type RepeatGapPenalties struct {
+	MaxUnitLen   int    // Maximum length of repeat units, 1 for homopolymers only.
+	MinRepeatLen int    // Minimum length of a repeat region, which also contains at least two units.
+	GapOpen      uint32 // Gap open penalty in repeats.
+	GapExt       uint32 // Gap extension penalty in repeats.
+}
+
+// DefaultRepeatGapPenalties halves the default gap penalties in homopolymers of at least 3 bases.
+var DefaultRepeatGapPenalties = &RepeatGapPenalties{
+	MaxUnitLen:   1,
+	MinRepeatLen: 3,
+	GapOpen:      3,
+	GapExt:       1,
+}
+
+// ErrInvalidRepeatGapPenalties means the repeat gap penalties are not valid.
+var ErrInvalidRepeatGapPenalties error = fmt.Errorf("wfa: invalid repeat gap penalties")
+
+// RepeatGapPenalties sets the gap penalties in homopolymers or short tandem repeats.
+// A nil value disables it.
+func (algn *Aligner) RepeatGapPenalties(rp *RepeatGapPenalties) error {
+	if rp != nil && (rp.MaxUnitLen < 1 || rp.MinRepeatLen < 2 || rp.GapExt == 0) {
+		return ErrInvalidRepeatGapPenalties
+	}
+	algn.rp = rp
+	return nil
+}
+
+// gapPenalties stores position-specific gap penalties.
+// Open penalties also contain the extension penalties.
+type gapPenalties struct {
+	insOpen, insExt posPenalties // for target positions
+	delOpen, delExt posPenalties // for query positions
+}
+
+// markRepeats marks positions in repeats of a sequence of length n.
+// eq tells whether the bases at i and j (0-based) are identical.
+func markRepeats(n int, eq func(i, j int) bool, rp *RepeatGapPenalties, marks []bool) {
+	var a, l int
+	for u := 1; u <= rp.MaxUnitLen && u < n; u++ {
+		l = max(rp.MinRepeatLen, u<<1)
+
+		// s[a-u:j] is periodic with a period of u.
+		a = u
+		for j := u; j <= n; j++ {
+			if j < n && eq(j, j-u) {
+				continue
+			}
+			if j-a+u >= l {
+				for i := a - u; i < j; i++ {
+					marks[i] = true
+				}
+			}
+			a = j + 1
+		}
+	}
+}
+
+// prepareRepeats computes the gap penalties of each base into gp.
+// It returns nil if repeats can not be marked in the sequences.
+func (algn *Aligner) prepareRepeats(seqs sequences, gp *gapPenalties) *gapPenalties {
+	rp := algn.rp
+	p := algn.p
+	lenQ, lenT := seqs.lens()
+
+	marksT := make([]bool, lenT)
+	if !seqs.markRepeats(false, rp, marksT) {
+		return nil
+	}
+	marksQ := make([]bool, lenQ)
+	seqs.markRepeats(true, rp, marksQ)
+
+	fill := func(marks []bool, open, ext *posPenalties) {
+		open.reset()
+		ext.reset()
+		for _, r := range marks {
+			if r {
+				open.add(rp.GapOpen + rp.GapExt)
+				ext.add(rp.GapExt)
+			} else {
+				open.add(p.GapOpen + p.GapExt)
+				ext.add(p.GapExt)
+			}
+		}
+	}
+	fill(marksT, &gp.insOpen, &gp.insExt)
+	fill(marksQ, &gp.delOpen, &gp.delExt)
+
+	return gp
+}
+
+// gapKRanges returns the k ranges of all possible source wavefronts of
+// gap opening (M), insertion extension (I) and deletion extension (D).
+func (algn *Aligner) gapKRanges(s uint32) (loGapOpen, hiGapOpen, loInsert, hiInsert, loDelete, hiDelete int) {
+	p := algn.p
+	gp := algn.gaps
+	if gp == nil {
+		loGapOpen, hiGapOpen = algn.M.KRange(s, p.GapOpen+p.GapExt) // M[s-o-e]
+		loInsert, hiInsert = algn.I.KRange(s, p.GapExt)             // I[s-e]
+		loDelete, hiDelete = algn.D.KRange(s, p.GapExt)             // D[s-e]
+		return
+	}
+	lo1, hi1 := kRange(algn.M, s, &gp.insOpen, 0)
+	lo2, hi2 := kRange(algn.M, s, &gp.delOpen, 0)
+	loGapOpen, hiGapOpen = min(lo1, lo2), max(hi1, hi2)
+	loInsert, hiInsert = kRange(algn.I, s, &gp.insExt, 0)
+	loDelete, hiDelete = kRange(algn.D, s, &gp.delExt, 0)
+	return
+}
+
+// insertSources returns M[s-o-e][k-1] and I[s-e][k-1] for the insertion I[s][k].
+func (algn *Aligner) insertSources(s uint32, k int) (uint32, bool, uint32, bool) {
+	p := algn.p
+	gp := algn.gaps
+	// the target position of the next cell (1-based) is offset+1,
+	// i.e., the 0-based index is offset.
+	if gp == nil {
+		v1, _, fromM := algn.M.GetAfterDiff(s, p.GapOpen+p.GapExt, k-1)
+		v2, _, fromI := algn.I.GetAfterDiff(s, p.GapExt, k-1)
+		return v1, fromM, v2, fromI
+	}
+	v1, fromM := getPositional(algn.M, s, k-1, &gp.insOpen, 0, 0)
+	v2, fromI := getPositional(algn.I, s, k-1, &gp.insExt, 0, 0)
+	return v1, fromM, v2, fromI
+}
+
+// deleteSources returns M[s-o-e][k+1] and D[s-e][k+1] for the deletion D[s][k].
+func (algn *Aligner) deleteSources(s uint32, k int) (uint32, bool, uint32, bool) {
+	p := algn.p
+	gp := algn.gaps
+	// the query position of the next cell (1-based) is offset-k,
+	// i.e., the 0-based index is offset-k-1.
+	if gp == nil {
+		v1, _, fromM := algn.M.GetAfterDiff(s, p.GapOpen+p.GapExt, k+1)
+		v2, _, fromD := algn.D.GetAfterDiff(s, p.GapExt, k+1)
+		return v1, fromM, v2, fromD
+	}
+	v1, fromM := getPositional(algn.M, s, k+1, &gp.delOpen, 0, -k-1)
+	v2, fromD := getPositional(algn.D, s, k+1, &gp.delExt, 0, -k-1)
+	return v1, fromM, v2, fromD
+}
+
+// gapPenalty returns the penalty of a gap cell of a given type,
+// at a 1-based query position v and target position h.
+func (algn *Aligner) gapPenalty(wfaType uint32, v, h int) uint32 {
+	p := algn.p
+	gp := algn.gaps
+	if gp == nil {
+		switch wfaType {
+		case wfaInsertOpen, wfaDeleteOpen:
+			return p.GapOpen + p.GapExt
+		default:
+			return p.GapExt
+		}
+	}
+	switch wfaType {
+	case wfaInsertOpen:
+		return gp.insOpen.at(h - 1)
+	case wfaInsertExt:
+		return gp.insExt.at(h - 1)
+	case wfaDeleteOpen:
+		return gp.delOpen.at(v - 1)
+	default:
+		return gp.delExt.at(v - 1)
+	}
+}
+
+// prepareQuality computes the mismatch penalty of each query base into pp.
+func (algn *Aligner) prepareQuality(qual []byte, pp *posPenalties) *posPenalties {
+	qp := algn.qp
+	if qp == nil {
+		qp = DefaultQualityPenalties
+	}
+	pp.reset()
+	for _, b := range qual {
+		pp.add(qp.penalty(b))
+	}
+	return pp
+}
+
+// mismatchKRange returns the k range of all possible source wavefronts of mismatches.
+func (algn *Aligner) mismatchKRange(s uint32) (int, int) {
+	return kRange(algn.M, s, algn.mis, algn.p.Mismatch)
+}
+
+// mismatchSource returns M[s-x][k], where x is the mismatch penalty of the cell
+// the offset moves to.
+func (algn *Aligner) mismatchSource(s uint32, k int) (uint32, bool) {
+	// the query position of the next cell (1-based) is offset+1-k,
+	// i.e., the 0-based index is offset-k.
+	return getPositional(algn.M, s, k, algn.mis, algn.p.Mismatch, -k)
+}
+
+// mismatchPenalty returns the mismatch penalty of a 1-based query position.
+func (algn *Aligner) mismatchPenalty(v int) uint32 {
+	if algn.mis == nil {
+		return algn.p.Mismatch
+	}
+	return algn.mis.at(v - 1)
+}
+
+// AlignWithQuality performs alignment with two sequences,
+// where the mismatch penalties are decided by the qualities of query bases.
+// Quality penalties can be set with QualityPenalties(),
+// and DefaultQualityPenalties is used if not given.
+func (algn *Aligner) AlignWithQuality(q, qual, t []byte) (*AlignmentResult, error) {
+	if len(qual) != len(q) {
+		return nil, ErrQualityLen
+	}
+	algn.mis = algn.prepareQuality(qual, &algn._mis)
+	defer func() { algn.mis = nil }()
+	return algn.align(algn.bytes(&q, &t))
+}
+
+// Rescore recomputes the alignment score of a result with the penalties of the aligner,
+// including the context-dependent gap penalties set by RepeatGapPenalties().
+// It can be used to verify the score of an alignment.
+func (algn *Aligner) Rescore(q, t []byte, cigar *AlignmentResult) uint32 {
+	return algn.rescoreSeqs(nil, algn.bytes(&q, &t), cigar)
+}
+
+// RescoreWithQuality recomputes the alignment score of a result returned by AlignWithQuality().
+func (algn *Aligner) RescoreWithQuality(q, qual, t []byte, cigar *AlignmentResult) (uint32, error) {
+	if len(qual) != len(q) {
+		return 0, ErrQualityLen
+	}
+	return algn.rescoreSeqs(algn.prepareQuality(qual, &algn._rmis), algn.bytes(&q, &t), cigar), nil
+}
+
+// rescoreSeqs computes the score of an alignment with the given mismatch penalties,
+// and penalties of the last alignment are restored after it.
+func (algn *Aligner) rescoreSeqs(mis *posPenalties, seqs sequences, cigar *AlignmentResult) uint32 {
+	defer func(mis *posPenalties, gaps *gapPenalties) {
+		algn.mis, algn.gaps = mis, gaps
+	}(algn.mis, algn.gaps)
+
+	algn.mis = mis
+	algn.gaps = algn.prepareGaps(seqs, &algn._rgaps)
+	return algn.rescore(cigar)
+}
+
+// prepareGaps computes position-specific gap penalties into gp if needed.
+func (algn *Aligner) prepareGaps(seqs sequences, gp *gapPenalties) *gapPenalties {
+	if algn.rp == nil {
+		return nil
+	}
+	return algn.prepareRepeats(seqs, gp)
+}
+
+// rescore computes the score of an alignment.
+// For semi-global alignment, the same as the aligner, clippings (H) are free,
+// and so are leading insertions (I) on the first row, and trailing insertions
+// on the last row after the target position reaches lenQ.
+func (algn *Aligner) rescore(cigar *AlignmentResult) uint32 {
+	cigar.process()
+	ops := cigar.Ops
+
+	var lenQ int
+	last := -1 // the last match or mismatch
+	for i, op := range ops {
+		switch op >> 32 {
+		case OpM, OpX:
+			lenQ += int(op & MaskLower32)
+			last = i
+		case OpD, OpH:
+			lenQ += int(op & MaskLower32)
+		}
+	}
+
+	var score uint32
+	var v, h int // 0-based positions of the next bases
+	var n, j, c uint32
+	leading := !cigar.globalAlignment
+	for i, op := range ops {
+		n = uint32(op & MaskLower32)
+		if leading && op>>32 != OpI && op>>32 != OpH {
+			leading = false
+		}
+		switch op >> 32 {
+		case OpM:
+			v += int(n)
+			h += int(n)
+		case OpX:
+			for j = 0; j < n; j++ {
+				score += algn.mismatchPenalty(v + 1)
+				v++
+				h++
+			}
+		case OpI:
+			// the number of penalized bases
+			c = n
+			if leading && v == 0 { // starting on the first row
+				c = 0
+			} else if !cigar.globalAlignment && i > last && v == lenQ { // ending on the last row with h >= lenQ
+				c = uint32(min(int(n), max(0, lenQ-h)))
+			}
+			if c > 0 {
+				score += algn.gapPenalty(wfaInsertOpen, v, h+1)
+				for j = 1; j < c; j++ {
+					score += algn.gapPenalty(wfaInsertExt, v, h+int(j)+1)
+				}
+			}
+			h += int(n)
+		case OpD:
+			score += algn.gapPenalty(wfaDeleteOpen, v+1, h)
+			for j = 1; j < n; j++ {
+				score += algn.gapPenalty(wfaDeleteExt, v+int(j)+1, h)
+			}
+			v += int(n)
+		case OpH:
+			v += int(n)
+		}
+	}
+	return score
+}
+
+func isMatchOrMismatch(op uint64) bool {
+	return op>>32 == OpM || op>>32 == OpX
+}
@@ -0,0 +1,415 @@
+// Copyright © 2024 Wei Shen <shenwei356@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package wfa
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+)
+
+// POA is a partial-order alignment (POA) graph of reads, for calling consensus sequences
+// of amplicons or reads of the same UMI group.
+// Each node is a base, and nodes of different bases aligned to each other are
+// put in the same column of the multiple sequence alignment (MSA).
+//
+// Reads are aligned to the graph end to end, with a wavefront-based sequence-to-graph alignment.
+// It is experimental and only suitable for short reads like amplicons.
+type POA struct {
+	p           *Penalties
+	maxDistDiff int // for reduction, 0 for disabled
+
+	bases   []byte  // bases of nodes
+	out     [][]int // successors of nodes
+	weights [][]int // weights of edges to successors, i.e., the numbers of reads
+	aligned []int   // the next node in the ring of nodes aligned to each other
+
+	reads [][]int // nodes of bases of each read
+}
+
+// NewPOA creates a new POA graph with the penalties (DefaultPenalties if nil).
+// Adaptive reduction is enabled with DefaultAdaptiveOption.
+func NewPOA(p *Penalties) *POA {
+	if p == nil {
+		p = DefaultPenalties
+	}
+	return &POA{
+		p:           p,
+		maxDistDiff: int(DefaultAdaptiveOption.MaxDistDiff),
+		bases:       make([]byte, 0, 1024),
+		out:         make([][]int, 0, 1024),
+		weights:     make([][]int, 0, 1024),
+		aligned:     make([]int, 0, 1024),
+		reads:       make([][]int, 0, 64),
+	}
+}
+
+// AdaptiveReduction sets the adaptive reduction parameters, nil for disabling it.
+// Only MaxDistDiff is used, where the distance of a cell to the end in the graph is estimated
+// with the mean positions of the node in reads.
+func (poa *POA) AdaptiveReduction(ad *AdaptiveReductionOption) {
+	if ad == nil {
+		poa.maxDistDiff = 0
+		return
+	}
+	poa.maxDistDiff = int(ad.MaxDistDiff)
+}
+
+// NumReads returns the number of reads in the graph.
+func (poa *POA) NumReads() int { return len(poa.reads) }
+
+// NumNodes returns the number of nodes in the graph.
+func (poa *POA) NumNodes() int { return len(poa.bases) }
+
+// Add aligns a read to the graph, and adds it into the graph.
+// Reads should be from the same strand.
+func (poa *POA) Add(read []byte) error {
+	if len(read) == 0 {
+		return ErrEmptySeq
+	}
+	nodes := make([]int, 0, len(read))
+
+	if len(poa.bases) == 0 { // the first read
+		prev := -1
+		for _, b := range read {
+			u := poa.newNode(b)
+			poa.addEdge(prev, u)
+			nodes = append(nodes, u)
+			prev = u
+		}
+		poa.reads = append(poa.reads, nodes)
+		return nil
+	}
+
+	g, src, sink := poa.graph()
+	gw := newGraphWFA(poa.p, g, read)
+	gw.sink = sink
+	if poa.maxDistDiff > 0 {
+		gw.remain, gw.maxDistDiff = poa.remain(src, sink), poa.maxDistDiff
+	}
+	gw.align(src, 0)
+	path, _, _ := gw.backtrace()
+	cigar := gw.cigar
+	path = path[1 : len(path)-1] // removing the source and sink nodes
+
+	prev := -1
+	var i, v, u int // index in the path, position in the read, and the current node
+	var n uint32
+	for _, op := range cigar.Ops {
+		for n = uint32(op & MaskLower32); n > 0; n-- {
+			switch op >> 32 {
+			case OpM:
+				u = path[i]
+				i++
+			case OpX:
+				u = poa.alignedNode(path[i], read[v])
+				i++
+			case OpI: // the node is skipped by the read
+				i++
+				continue
+			default: // OpD, a new base
+				u = poa.newNode(read[v])
+			}
+			v++
+			poa.addEdge(prev, u)
+			nodes = append(nodes, u)
+			prev = u
+		}
+	}
+	RecycleAlignmentResult(cigar)
+
+	poa.reads = append(poa.reads, nodes)
+	return nil
+}
+
+// graph converts the POA graph into a Graph for alignment, where the handle of a node is its index,
+// with two extra empty nodes: a source connected to nodes without predecessors,
+// and a sink connected from nodes without successors.
+func (poa *POA) graph() (*Graph, int, int) {
+	N := len(poa.bases)
+	src, sink := N, N+1
+	g := &Graph{
+		seqs: make([][]byte, N+2),
+		succ: make([][]int, N+2),
+	}
+	hasPred := make([]bool, N)
+	for u := 0; u < N; u++ {
+		g.seqs[u] = poa.bases[u : u+1]
+		if len(poa.out[u]) == 0 {
+			g.succ[u] = []int{sink}
+			continue
+		}
+		g.succ[u] = poa.out[u]
+		for _, w := range poa.out[u] {
+			hasPred[w] = true
+		}
+	}
+	for u, ok := range hasPred {
+		if !ok {
+			g.succ[src] = append(g.succ[src], u)
+		}
+	}
+	return g, src, sink
+}
+
+// remain estimates the numbers of remaining bases from nodes to the end of reads,
+// with the mean length of reads and the mean positions of nodes in reads.
+func (poa *POA) remain(src, sink int) []int {
+	N := len(poa.bases)
+	sums := make([]int, N)
+	counts := make([]int, N)
+	var total int
+	for _, nodes := range poa.reads {
+		total += len(nodes)
+		for i, u := range nodes {
+			sums[u] += i
+			counts[u]++
+		}
+	}
+	L := total / len(poa.reads)
+
+	remain := make([]int, N+2)
+	for u := 0; u < N; u++ {
+		remain[u] = max(0, L-sums[u]/counts[u])
+	}
+	remain[src], remain[sink] = L, 0
+	return remain
+}
+
+// newNode adds a new node of a base, and returns its index.
+func (poa *POA) newNode(b byte) int {
+	u := len(poa.bases)
+	poa.bases = append(poa.bases, b)
+	poa.out = append(poa.out, nil)
+	poa.weights = append(poa.weights, nil)
+	poa.aligned = append(poa.aligned, u)
+	return u
+}
+
+// alignedNode returns the node of a base, which is u or one aligned to u.
+// A new one is created if it does not exist.
+func (poa *POA) alignedNode(u int, b byte) int {
+	if poa.bases[u] == b {
+		return u
+	}
+	for w := poa.aligned[u]; w != u; w = poa.aligned[w] {
+		if poa.bases[w] == b {
+			return w
+		}
+	}
+	w := poa.newNode(b)
+	poa.aligned[w] = poa.aligned[u]
+	poa.aligned[u] = w
+	return w
+}
+
+// addEdge adds an edge from u to w, or increases its weight.
+func (poa *POA) addEdge(u, w int) {
+	if u < 0 {
+		return
+	}
+	for i, x := range poa.out[u] {
+		if x == w {
+			poa.weights[u][i]++
+			return
+		}
+	}
+	poa.out[u] = append(poa.out[u], w)
+	poa.weights[u] = append(poa.weights[u], 1)
+}
+
+// Consensus returns the consensus sequence, i.e., bases of the heaviest path,
+// where the weight of an edge is the number of reads passing through it.
+// Like the heaviest bundle algorithm, each node chooses the predecessor with the heaviest edge,
+// and nodes at the two ends supported by less than half of reads are trimmed.
+func (poa *POA) Consensus() []byte {
+	N := len(poa.bases)
+	if N == 0 {
+		return nil
+	}
+	scores := make([]int, N)
+	weights := make([]int, N) // weights of the chosen edges to nodes
+	from := make([]int, N)
+	for u := range from {
+		from[u] = -1
+	}
+	best := -1
+	for _, u := range poa.topoOrder() {
+		if best < 0 || scores[u] > scores[best] {
+			best = u
+		}
+		for i, w := range poa.out[u] {
+			x := poa.weights[u][i]
+			if x > weights[w] || x == weights[w] && scores[u] > scores[from[w]] {
+				weights[w], scores[w], from[w] = x, scores[u]+x, u
+			}
+		}
+	}
+
+	// the path, in reversed order
+	path := make([]int, 0, 1024)
+	for u := best; u >= 0; u = from[u] {
+		path = append(path, u)
+	}
+
+	// trimming nodes with low coverage at the two ends
+	coverage := make([]int, N)
+	for _, nodes := range poa.reads {
+		for _, u := range nodes {
+			coverage[u]++
+		}
+	}
+	half := (len(poa.reads) + 1) / 2
+	i, j := 0, len(path)-1
+	for i < j && coverage[path[i]] < half {
+		i++
+	}
+	for j > i && coverage[path[j]] < half {
+		j--
+	}
+
+	seq := make([]byte, 0, j-i+1)
+	for ; j >= i; j-- {
+		seq = append(seq, poa.bases[path[j]])
+	}
+	return seq
+}
+
+// topoOrder returns nodes in a topological order.
+func (poa *POA) topoOrder() []int {
+	N := len(poa.bases)
+	indeg := make([]int, N)
+	for u := 0; u < N; u++ {
+		for _, w := range poa.out[u] {
+			indeg[w]++
+		}
+	}
+	order := make([]int, 0, N)
+	for u, d := range indeg {
+		if d == 0 {
+			order = append(order, u)
+		}
+	}
+	for i := 0; i < len(order); i++ {
+		for _, w := range poa.out[order[i]] {
+			if indeg[w]--; indeg[w] == 0 {
+				order = append(order, w)
+			}
+		}
+	}
+	return order
+}
+
+// columns assigns MSA columns to nodes, where nodes aligned to each other share the same column,
+// and returns the number of columns.
+func (poa *POA) columns() ([]int, int) {
+	N := len(poa.bases)
+
+	// groups of aligned nodes
+	group := make([]int, N)
+	for u := range group {
+		group[u] = -1
+	}
+	var G int
+	for u := 0; u < N; u++ {
+		if group[u] >= 0 {
+			continue
+		}
+		group[u] = G
+		for w := poa.aligned[u]; w != u; w = poa.aligned[w] {
+			group[w] = G
+		}
+		G++
+	}
+
+	// topological sorting of groups
+	indeg := make([]int, G)
+	for u := 0; u < N; u++ {
+		for _, w := range poa.out[u] {
+			indeg[group[w]]++
+		}
+	}
+	members := make([][]int, G)
+	for u := 0; u < N; u++ {
+		members[group[u]] = append(members[group[u]], u)
+	}
+	order := make([]int, 0, G)
+	for g, d := range indeg {
+		if d == 0 {
+			order = append(order, g)
+		}
+	}
+	for i := 0; i < len(order); i++ {
+		for _, u := range members[order[i]] {
+			for _, w := range poa.out[u] {
+				if indeg[group[w]]--; indeg[group[w]] == 0 {
+					order = append(order, group[w])
+				}
+			}
+		}
+	}
+
+	col := make([]int, G)
+	for i, g := range order {
+		col[g] = i
+	}
+	cols := make([]int, N)
+	for u := range cols {
+		cols[u] = col[group[u]]
+	}
+	return cols, len(order)
+}
+
+// MSA returns the multiple sequence alignment of reads, in the order they are added.
+// Gaps are represented by "-".
+func (poa *POA) MSA() [][]byte {
+	cols, n := poa.columns()
+	rows := make([][]byte, len(poa.reads))
+	for r, nodes := range poa.reads {
+		row := make([]byte, n)
+		for j := range row {
+			row[j] = '-'
+		}
+		for _, u := range nodes {
+			row[cols[u]] = poa.bases[u]
+		}
+		rows[r] = row
+	}
+	return rows
+}
+
+// WriteMSA writes the multiple sequence alignment of reads in FASTA format.
+// names are the names of reads, and their indexes are used if it is nil.
+func (poa *POA) WriteMSA(w io.Writer, names []string) error {
+	if names != nil && len(names) != len(poa.reads) {
+		return fmt.Errorf("wfa: the number of names (%d) does not match the number of reads (%d)",
+			len(names), len(poa.reads))
+	}
+	bw := bufio.NewWriter(w)
+	for r, row := range poa.MSA() {
+		if names != nil {
+			fmt.Fprintf(bw, ">%s\n%s\n", names[r], row)
+		} else {
+			fmt.Fprintf(bw, ">%d\n%s\n", r+1, row)
+		}
+	}
+	return bw.Flush()
+}
@@ -0,0 +1,167 @@
+// Copyright © 2024 Wei Shen <shenwei356@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package wfa
+
+import (
+	"encoding/binary"
+	"math/bits"
+)
+
+// sequences is a pair of query and target sequences to align.
+type sequences interface {
+	// lens returns the lengths of the query and target.
+	lens() (int, int)
+
+	// equal tells whether the query base at v and the target base at h (0-based) are identical.
+	equal(v, h int) bool
+
+	// extend returns the number of consecutive identical bases,
+	// starting from the query position v and the target position h (0-based).
+	extend(v, h int) int
+
+	// markRepeats marks positions in repeats of the query or target.
+	// It returns false if it is not supported, where RepeatGapPenalties is ignored.
+	markRepeats(query bool, rp *RepeatGapPenalties, marks []bool) bool
+}
+
+// byteSeqs is a pair of byte sequences, it's the default one.
+type byteSeqs struct {
+	q, t []byte
+}
+
+func (s *byteSeqs) lens() (int, int) { return len(s.q), len(s.t) }
+
+func (s *byteSeqs) equal(v, h int) bool { return s.q[v] == s.t[h] }
+
+var be = binary.BigEndian
+
+func (s *byteSeqs) extend(v, h int) int {
+	q, t := s.q, s.t
+	lenQ, lenT := len(q), len(t)
+	var n, N int
+
+	// compare every 8 bases, convert 8 bases to a uint64, xor them and count leading zeroes.
+	for v+8 <= lenQ && h+8 <= lenT {
+		n = bits.LeadingZeros64(be.Uint64(q[v:v+8])^be.Uint64(t[h:h+8])) >> 3 // divide 8
+		v += n
+		h += n
+		N += n
+		if n < 8 {
+			return N
+		}
+	}
+
+	// compare each base
+	for v < lenQ && h < lenT && q[v] == t[h] {
+		v++
+		h++
+		N++
+	}
+	return N
+}
+
+func (s *byteSeqs) markRepeats(query bool, rp *RepeatGapPenalties, marks []bool) bool {
+	if query {
+		markRepeats(len(s.q), func(i, j int) bool { return s.q[i] == s.q[j] }, rp, marks)
+	} else {
+		markRepeats(len(s.t), func(i, j int) bool { return s.t[i] == s.t[j] }, rp, marks)
+	}
+	return true
+}
+
+// tokenSeqs is a pair of sequences of any comparable type.
+type tokenSeqs[T comparable] struct {
+	q, t []T
+}
+
+func (s *tokenSeqs[T]) lens() (int, int) { return len(s.q), len(s.t) }
+
+func (s *tokenSeqs[T]) equal(v, h int) bool { return s.q[v] == s.t[h] }
+
+func (s *tokenSeqs[T]) extend(v, h int) int {
+	q, t := s.q, s.t
+	var N int
+	for v < len(q) && h < len(t) && q[v] == t[h] {
+		v++
+		h++
+		N++
+	}
+	return N
+}
+
+// RepeatGapPenalties is only for nucleotide sequences.
+func (s *tokenSeqs[T]) markRepeats(query bool, rp *RepeatGapPenalties, marks []bool) bool {
+	return false
+}
+
+// Matcher tells whether the query base at v and the target base at h (0-based) are identical.
+// It's used for sequences which are lazily generated or stored in compressed forms.
+type Matcher interface {
+	Match(v, h int) bool
+}
+
+// MatchFunc is a function which implements the Matcher interface.
+type MatchFunc func(v, h int) bool
+
+// Match implements the Matcher interface.
+func (f MatchFunc) Match(v, h int) bool { return f(v, h) }
+
+// matcherSeqs is a pair of sequences only accessed via a Matcher.
+type matcherSeqs struct {
+	lenQ, lenT int
+	m          Matcher
+}
+
+func (s *matcherSeqs) lens() (int, int) { return s.lenQ, s.lenT }
+
+func (s *matcherSeqs) equal(v, h int) bool { return s.m.Match(v, h) }
+
+func (s *matcherSeqs) extend(v, h int) int {
+	var N int
+	for v < s.lenQ && h < s.lenT && s.m.Match(v, h) {
+		v++
+		h++
+		N++
+	}
+	return N
+}
+
+// bases in the same sequence can not be compared.
+func (s *matcherSeqs) markRepeats(query bool, rp *RepeatGapPenalties, marks []bool) bool {
+	return false
+}
+
+// AlignMatcher performs alignment with the lengths of the query and target sequences,
+// and a Matcher for comparing bases, like the "lambda" mode of WFA2-lib.
+// Sequences are not needed in backtrace, so the result can be used as usual.
+// Note that the RepeatGapPenalties is ignored, as bases in the same sequence can not be compared.
+func (algn *Aligner) AlignMatcher(lenQ, lenT int, m Matcher) (*AlignmentResult, error) {
+	algn._matcher.lenQ, algn._matcher.lenT, algn._matcher.m = lenQ, lenT, m
+	return algn.align(&algn._matcher)
+}
+
+// AlignGeneric performs alignment with two sequences of any comparable type,
+// e.g., k-mer IDs, protein segments encoded as uint16, words, or graph node IDs.
+// All the features of the aligner are supported, except AlignWithQuality() and RepeatGapPenalties().
+// For byte sequences, Aligner.Align() is faster.
+func AlignGeneric[T comparable](algn *Aligner, q, t []T) (*AlignmentResult, error) {
+	return algn.align(&tokenSeqs[T]{q: q, t: t})
+}
@@ -0,0 +1,94 @@
+// Copyright © 2024 Wei Shen <shenwei356@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package wfa
+
+// AlignmentStats contains detailed stats of the aligned region,
+// no including flanking clipping/insertion sequences.
+type AlignmentStats struct {
+	AlignLen   uint32 `json:"align_len"` // Alignment length, i.e., the number of columns
+	Matches    uint32 `json:"matches"`
+	Mismatches uint32 `json:"mismatches"`
+
+	InsertedBases uint32 `json:"inserted_bases"` // Bases in insertions, i.e., "I" in CIGAR
+	DeletedBases  uint32 `json:"deleted_bases"`  // Bases in deletions, i.e., "D" in CIGAR
+	Insertions    uint32 `json:"insertions"`     // The number of insertion events
+	Deletions     uint32 `json:"deletions"`      // The number of deletion events
+
+	LongestGap uint32   `json:"longest_gap"`  // Length of the longest gap
+	GapLenHist []uint32 `json:"gap_len_hist"` // Histogram of gap lengths, GapLenHist[L] is the number of gaps of length L
+}
+
+func (stats *AlignmentStats) reset() {
+	stats.AlignLen = 0
+	stats.Matches = 0
+	stats.Mismatches = 0
+	stats.InsertedBases = 0
+	stats.DeletedBases = 0
+	stats.Insertions = 0
+	stats.Deletions = 0
+	stats.LongestGap = 0
+	stats.GapLenHist = stats.GapLenHist[:0]
+}
+
+// addGap records a gap of length n.
+func (stats *AlignmentStats) addGap(n uint32) {
+	for uint32(len(stats.GapLenHist)) <= n {
+		stats.GapLenHist = append(stats.GapLenHist, 0)
+	}
+	stats.GapLenHist[n]++
+	if n > stats.LongestGap {
+		stats.LongestGap = n
+	}
+}
+
+// EditDistance returns the number of mismatches and gap bases.
+func (stats *AlignmentStats) EditDistance() uint32 {
+	return stats.Mismatches + stats.InsertedBases + stats.DeletedBases
+}
+
+// BLASTIdentity returns the BLAST identity, i.e., matches / alignment length.
+func (stats *AlignmentStats) BLASTIdentity() float64 {
+	if stats.AlignLen == 0 {
+		return 0
+	}
+	return float64(stats.Matches) / float64(stats.AlignLen)
+}
+
+// GapCompressedIdentity returns the gap-compressed identity, where a gap of any length
+// is counted as one difference, i.e., matches / (matches + mismatches + gap events).
+func (stats *AlignmentStats) GapCompressedIdentity() float64 {
+	n := stats.Matches + stats.Mismatches + stats.Insertions + stats.Deletions
+	if n == 0 {
+		return 0
+	}
+	return float64(stats.Matches) / float64(n)
+}
+
+// EditDistanceIdentity returns the edit-distance-based identity (read accuracy),
+// i.e., 1 - edit distance / length of the aligned query region.
+// It is clamped at 0 as the edit distance might be larger than the query length.
+func (stats *AlignmentStats) EditDistanceIdentity() float64 {
+	qlen := stats.Matches + stats.Mismatches + stats.DeletedBases // "D" consumes query bases
+	if qlen == 0 {
+		return 0
+	}
+	return max(0, 1-float64(stats.EditDistance())/float64(qlen))
+}
@@ -22,8 +22,11 @@ package wfa
 
 import (
 	"bytes"
+	"encoding/json"
 	"fmt"
+	"math/rand"
 	"os"
+	"strings"
 	"testing"
 )
 
@@ -183,3 +186,1362 @@ func TestWFA(_t *testing.T) {
 	}
 	RecycleAligner(algn)
 }
+
+func randSeq(r *rand.Rand, n int) []byte {
+	s := make([]byte, n)
+	for i := range s {
+		s[i] = "ACGT"[r.Intn(4)]
+	}
+	return s
+}
+
+// mutate introduces substitutions, deletions and insertions with a given rate.
+func mutate(r *rand.Rand, s []byte, rate float64) []byte {
+	m := make([]byte, 0, len(s))
+	var x float64
+	for _, b := range s {
+		x = r.Float64()
+		switch {
+		case x < rate/3:
+			m = append(m, "ACGT"[r.Intn(4)])
+		case x < rate*2/3:
+		case x < rate:
+			m = append(m, b, "ACGT"[r.Intn(4)])
+		default:
+			m = append(m, b)
+		}
+	}
+	if len(m) == 0 {
+		m = append(m, 'A')
+	}
+	return m
+}
+
+func TestAlignWithQuality(_t *testing.T) {
+	algn := New(DefaultPenalties, DefaultOptions)
+	defer RecycleAligner(algn)
+
+	// the low-quality mismatch is cheaper
+	q := []byte("ACGTACGTTA")
+	t := []byte("ACGTACGTCA")
+	qual := []byte("IIIIIIII#I")
+	result, err := algn.AlignWithQuality(q, qual, t)
+	if err != nil {
+		_t.Error(err)
+		return
+	}
+	if result.Score != DefaultQualityPenalties.Mismatches[0] {
+		_t.Errorf("unexpected score: %d", result.Score)
+	}
+	RecycleAlignmentResult(result)
+
+	// qualities should not affect following alignments
+	result, err = algn.Align(q, t)
+	if err != nil {
+		_t.Error(err)
+		return
+	}
+	if result.Score != DefaultPenalties.Mismatch {
+		_t.Errorf("unexpected score after AlignWithQuality(): %d", result.Score)
+	}
+	RecycleAlignmentResult(result)
+
+	// scores should be reproducible
+	r := rand.New(rand.NewSource(1))
+	for i := 0; i < 1000; i++ {
+		t = randSeq(r, 1+r.Intn(100))
+		q = mutate(r, t, 0.2)
+		qual = qual[:0]
+		for range q {
+			qual = append(qual, byte(33+r.Intn(41)))
+		}
+
+		result, err = algn.AlignWithQuality(q, qual, t)
+		if err != nil {
+			_t.Error(err)
+			return
+		}
+		if s, err := algn.RescoreWithQuality(q, qual, t, result); err != nil || s != result.Score {
+			_t.Errorf("score: %d, rescore: %d, cigar: %s, err: %v", result.Score, s, result.CIGAR(false), err)
+		}
+		if _, err = algn.RescoreWithQuality(q, qual[:len(qual)-1], t, result); err != ErrQualityLen {
+			_t.Errorf("qualities of invalid length are not detected")
+		}
+		RecycleAlignmentResult(result)
+	}
+}
+
+func TestRescoreSemiGlobal(_t *testing.T) {
+	opt := *DefaultOptions
+	opt.GlobalAlignment = false
+	algn := New(DefaultPenalties, &opt)
+	defer RecycleAligner(algn)
+
+	// the insertion before the trailing clipping is penalized
+	q := []byte("GCGCTGAGTCGCATGGGTCAAGAAAGGCCG")
+	t := []byte("CCTTTTTCATAACGTCCA")
+	result, err := algn.Align(q, t)
+	if err != nil {
+		_t.Error(err)
+		return
+	}
+	if s := algn.Rescore(q, t, result); s != result.Score {
+		_t.Errorf("score: %d, rescore: %d, cigar: %s", result.Score, s, result.CIGAR(false))
+	}
+	RecycleAlignmentResult(result)
+
+	// only the part of trailing insertions before h reaches lenQ is penalized
+	for _, pair := range [][2]string{
+		{"TGTGCC", "TGCCGCCC"},                // 2H4M4I
+		{"TACGA", "TCGATC"},                   // 1H1X3M2I
+		{"CCGCTGGTCCGTAC", "GCGTGGTCCGTACCC"}, // 2H2M1I10M2I
+	} {
+		q, t = []byte(pair[0]), []byte(pair[1])
+		result, err = algn.Align(q, t)
+		if err != nil {
+			_t.Error(err)
+			return
+		}
+		if s := algn.Rescore(q, t, result); s != result.Score {
+			_t.Errorf("score: %d, rescore: %d, cigar: %s", result.Score, s, result.CIGAR(false))
+		}
+		RecycleAlignmentResult(result)
+	}
+
+	// random pairs, where the query is a suffix or a prefix of a mutated target, or unrelated
+	r := rand.New(rand.NewSource(1))
+	for i := 0; i < 3000; i++ {
+		t = randSeq(r, 1+r.Intn(100))
+		switch i % 3 {
+		case 0:
+			q = mutate(r, t, 0.2)
+			q = q[r.Intn(len(q)+1):]
+		case 1:
+			q = mutate(r, t, 0.2)
+			q = q[:r.Intn(len(q)+1)]
+		default:
+			q = randSeq(r, 1+r.Intn(100))
+		}
+		if len(q) == 0 {
+			continue
+		}
+
+		result, err = algn.Align(q, t)
+		if err != nil {
+			_t.Error(err)
+			return
+		}
+		if s := algn.Rescore(q, t, result); s != result.Score {
+			_t.Errorf("score: %d, rescore: %d, cigar: %s", result.Score, s, result.CIGAR(false))
+		}
+		RecycleAlignmentResult(result)
+	}
+}
+
+func TestRepeatGapPenalties(_t *testing.T) {
+	algn := New(DefaultPenalties, DefaultOptions)
+	defer RecycleAligner(algn)
+	if err := algn.RepeatGapPenalties(DefaultRepeatGapPenalties); err != nil {
+		_t.Error(err)
+		return
+	}
+
+	// a deletion in a homopolymer
+	q := []byte("ACGTTTTTGACAGT")
+	t := []byte("ACGTTTTGACAGT")
+	result, err := algn.Align(q, t)
+	if err != nil {
+		_t.Error(err)
+		return
+	}
+	if result.Score != DefaultRepeatGapPenalties.GapOpen+DefaultRepeatGapPenalties.GapExt {
+		_t.Errorf("unexpected score: %d", result.Score)
+	}
+	RecycleAlignmentResult(result)
+
+	// scores should be reproducible
+	r := rand.New(rand.NewSource(1))
+	for i := 0; i < 1000; i++ {
+		t = randSeq(r, 1+r.Intn(100))
+		for j := 0; j+5 < len(t); j += 10 { // add some homopolymers
+			t[j+1], t[j+2], t[j+3] = t[j], t[j], t[j]
+		}
+		q = mutate(r, t, 0.2)
+
+		result, err = algn.Align(q, t)
+		if err != nil {
+			_t.Error(err)
+			return
+		}
+		if s := algn.Rescore(q, t, result); s != result.Score {
+			_t.Errorf("score: %d, rescore: %d, cigar: %s", result.Score, s, result.CIGAR(false))
+		}
+		RecycleAlignmentResult(result)
+	}
+}
+
+func TestIndelAlignment(_t *testing.T) {
+	q := []byte("GGCACACACATT")
+	t := []byte("GGCACACATT")
+
+	for ia, cigar := range map[IndelAlignment]string{
+		IndelLeftAligned:  "2M2D8M",
+		IndelRightAligned: "8M2D2M",
+	} {
+		algn := New(DefaultPenalties, &Options{GlobalAlignment: true, IndelAlignment: ia})
+		result, err := algn.Align(q, t)
+		if err != nil {
+			_t.Error(err)
+			return
+		}
+		if result.CIGAR(false) != cigar {
+			_t.Errorf("indel alignment %d, expected: %s, returned: %s", ia, cigar, result.CIGAR(false))
+		}
+		if result.Score != DefaultPenalties.GapOpen+DefaultPenalties.GapExt*2 {
+			_t.Errorf("unexpected score: %d", result.Score)
+		}
+
+		// as a post-process
+		result.LeftAlignIndels(&q, &t)
+		if result.CIGAR(false) != "2M2D8M" {
+			_t.Errorf("LeftAlignIndels, returned: %s", result.CIGAR(false))
+		}
+		result.RightAlignIndels(&q, &t)
+		if result.CIGAR(false) != "8M2D2M" {
+			_t.Errorf("RightAlignIndels, returned: %s", result.CIGAR(false))
+		}
+
+		RecycleAlignmentResult(result)
+		RecycleAligner(algn)
+	}
+}
+
+func TestVariants(_t *testing.T) {
+	t := []byte("ACGTACGGATCCATGCAGGTACCATTGACCA")
+	q := []byte("ACGTACTGATCATGCGCAGGTTACCATAAGACCA")
+
+	algn := New(DefaultPenalties, &Options{GlobalAlignment: true, IndelAlignment: IndelLeftAligned})
+	result, err := algn.Align(q, t)
+	if err != nil {
+		_t.Error(err)
+		return
+	}
+
+	expected := `chr	7	.	G	T	.	.	TYPE=SNV;QPOS=7
+chr	10	.	TC	T	.	.	TYPE=DEL;QPOS=10
+chr	14	.	T	TGC	.	.	TYPE=INS;QPOS=13
+chr	19	.	G	GT	.	.	TYPE=INS;QPOS=20
+chr	26	.	T	AA	.	.	TYPE=COMPLEX;QPOS=28
+`
+	var buf bytes.Buffer
+	WriteVCF(&buf, "chr", result.Variants(&q, &t))
+	if buf.String() != expected {
+		_t.Errorf("cigar: %s, unexpected variants:\n%s", result.CIGAR(false), buf.String())
+	}
+
+	buf.Reset()
+	WriteVCFHeader(&buf, VCFContig{ID: "chr", Length: len(t)})
+	if !bytes.Contains(buf.Bytes(), []byte("##contig=<ID=chr,length=31>\n")) {
+		_t.Errorf("missing contig line in VCF header:\n%s", buf.String())
+	}
+
+	RecycleAlignmentResult(result)
+	RecycleAligner(algn)
+}
+
+func TestLiftOver(_t *testing.T) {
+	q := []byte("ACGTACTGATCATGCGCAGGTTACCA")
+	t := []byte("ACGTACGGATCCATGCAGGTACCA")
+
+	algn := New(DefaultPenalties, &Options{GlobalAlignment: true, IndelAlignment: IndelLeftAligned})
+	result, err := algn.Align(q, t)
+	if err != nil {
+		_t.Error(err)
+		return
+	}
+	// 6M1X3M1I3M2D5M1D5M
+
+	for _, c := range []struct {
+		q, t int
+		pt   PosType
+	}{
+		{1, 1, PosMatch},
+		{7, 7, PosMismatch},
+		{11, 12, PosMatch},
+		{14, 14, PosGap},
+		{26, 24, PosMatch},
+		{27, 0, PosOutOfRange},
+	} {
+		if p, pt := result.QueryToTarget(c.q); p != c.t || pt != c.pt {
+			_t.Errorf("QueryToTarget(%d), expected: %d (%s), returned: %d (%s)", c.q, c.t, c.pt, p, pt)
+		}
+	}
+	if p, pt := result.TargetToQuery(11); p != 10 || pt != PosGap {
+		_t.Errorf("TargetToQuery(11), returned: %d (%s)", p, pt)
+	}
+
+	if s, e, ok := result.QueryIntervalToTarget(13, 16); !ok || s != 14 || e != 15 {
+		_t.Errorf("QueryIntervalToTarget(13, 16), returned: %d, %d, %v", s, e, ok)
+	}
+	if _, _, ok := result.QueryIntervalToTarget(14, 14); ok {
+		_t.Errorf("QueryIntervalToTarget(14, 14) should fail")
+	}
+	if s, e, ok := result.TargetIntervalToQuery(5, 13); !ok || s != 5 || e != 12 {
+		_t.Errorf("TargetIntervalToQuery(5, 13), returned: %d, %d, %v", s, e, ok)
+	}
+
+	RecycleAlignmentResult(result)
+	RecycleAligner(algn)
+}
+
+func TestWriteAlignment(_t *testing.T) {
+	q := []byte("ACGTACTGATCATGCG")
+	t := []byte("ACGTACGGATCCATGCG")
+
+	algn := New(DefaultPenalties, &Options{GlobalAlignment: true, IndelAlignment: IndelLeftAligned})
+	result, err := algn.Align(q, t)
+	if err != nil {
+		_t.Error(err)
+		return
+	}
+
+	expected := `q  1 ACGTACTGAT 10
+     ||||||.|||
+t  1 ACGTACGGAT 10
+
+q 11 -CATGCG 16
+      ||||||
+t 11 CCATGCG 17
+
+`
+	var buf bytes.Buffer
+	err = result.WriteAlignment(&buf, &q, &t, &FormatOptions{Width: 10, QueryName: "q", TargetName: "t", Symbols: true})
+	if err != nil {
+		_t.Error(err)
+		return
+	}
+	text := buf.String()
+	text = text[bytes.Index(buf.Bytes(), []byte("\n\n"))+2:] // skip the header
+	if text != expected {
+		_t.Errorf("unexpected alignment text:\n%s", text)
+	}
+
+	RecycleAlignmentResult(result)
+	RecycleAligner(algn)
+}
+
+func TestAlignmentStats(_t *testing.T) {
+	q := []byte("ACGTACTGATCATGCGCAGGTTACCA")
+	t := []byte("ACGTACGGATCCATGCAGGTACCA")
+
+	algn := New(DefaultPenalties, &Options{GlobalAlignment: true, IndelAlignment: IndelLeftAligned})
+	result, err := algn.Align(q, t)
+	if err != nil {
+		_t.Error(err)
+		return
+	}
+	// 6M1X3M1I3M2D5M1D5M
+	stats := &result.Stats
+	if stats.AlignLen != 27 || stats.Matches != 22 || stats.Mismatches != 1 ||
+		stats.InsertedBases != 1 || stats.DeletedBases != 3 ||
+		stats.Insertions != 1 || stats.Deletions != 2 || stats.LongestGap != 2 ||
+		len(stats.GapLenHist) != 3 || stats.GapLenHist[1] != 2 || stats.GapLenHist[2] != 1 {
+		_t.Errorf("unexpected stats: %+v", *stats)
+	}
+	if stats.EditDistance() != 5 {
+		_t.Errorf("unexpected edit distance: %d", stats.EditDistance())
+	}
+	if id := stats.GapCompressedIdentity(); id != 22.0/26 {
+		_t.Errorf("unexpected gap-compressed identity: %f", id)
+	}
+	if id := (&AlignmentStats{Matches: 2, InsertedBases: 10}).EditDistanceIdentity(); id != 0 {
+		_t.Errorf("edit-distance-based identity is not clamped: %f", id)
+	}
+
+	RecycleAlignmentResult(result)
+	RecycleAligner(algn)
+}
+
+func TestSerialization(_t *testing.T) {
+	q := []byte("TTTTTACGTACTGATCATGCGCAGGTTACCAAAA")
+	t := []byte("GGGGGGACGTACGGATCCATGCAGGTACCACCCCC")
+
+	for _, global := range []bool{true, false} {
+		algn := New(DefaultPenalties, &Options{GlobalAlignment: global})
+		result, err := algn.Align(q, t)
+		if err != nil {
+			_t.Error(err)
+			return
+		}
+		cigar := result.CIGAR(false)
+
+		check := func(name string, r *AlignmentResult) {
+			if r.CIGAR(false) != cigar || r.Score != result.Score || r.globalAlignment != global ||
+				r.QBegin != result.QBegin || r.QEnd != result.QEnd ||
+				r.TBegin != result.TBegin || r.TEnd != result.TEnd ||
+				r.AlignLen != result.AlignLen || r.Matches != result.Matches ||
+				r.Stats.Mismatches != result.Stats.Mismatches ||
+				r.Stats.LongestGap != result.Stats.LongestGap {
+				_t.Errorf("%s round-trip failed, expected: %s, returned: %s", name, cigar, r.CIGAR(false))
+			}
+		}
+
+		data, err := json.Marshal(result)
+		if err != nil {
+			_t.Error(err)
+			return
+		}
+		r1 := NewAlignmentResult(false)
+		if err = json.Unmarshal(data, r1); err != nil {
+			_t.Error(err)
+			return
+		}
+		check("JSON", r1)
+
+		data, err = result.MarshalBinary()
+		if err != nil {
+			_t.Error(err)
+			return
+		}
+		r2 := NewAlignmentResult(false)
+		if err = r2.UnmarshalBinary(data); err != nil {
+			_t.Error(err)
+			return
+		}
+		check("binary", r2)
+		if r2.UnmarshalBinary(data[:len(data)-1]) == nil {
+			_t.Errorf("truncated binary data should fail")
+		}
+
+		RecycleAlignmentResult(r1)
+		RecycleAlignmentResult(r2)
+		RecycleAlignmentResult(result)
+		RecycleAligner(algn)
+	}
+
+	if json.Unmarshal([]byte(`{"cigar":"3M2Q"}`), &AlignmentResult{}) == nil {
+		_t.Errorf("invalid CIGAR should fail")
+	}
+}
+
+func TestAlignGeneric(_t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+
+	for i := 0; i < 20; i++ {
+		t := randSeq(r, 200+r.Intn(200))
+		q := mutate(r, t, 0.1)
+		q2, t2 := make([]uint16, len(q)), make([]uint16, len(t))
+		for j, b := range q {
+			q2[j] = uint16(b) << 8
+		}
+		for j, b := range t {
+			t2[j] = uint16(b) << 8
+		}
+
+		for _, global := range []bool{true, false} {
+			algn := New(DefaultPenalties, &Options{GlobalAlignment: global})
+			algn.AdaptiveReduction(DefaultAdaptiveOption)
+			if i&1 == 1 { // it is ignored for generic sequences
+				algn.RepeatGapPenalties(DefaultRepeatGapPenalties)
+			}
+			r2, err := AlignGeneric(algn, q2, t2)
+			if err != nil {
+				_t.Error(err)
+				return
+			}
+
+			algn.RepeatGapPenalties(nil)
+			r1, err := algn.Align(q, t)
+			if err != nil {
+				_t.Error(err)
+				return
+			}
+			if r1.Score != r2.Score || r1.CIGAR(false) != r2.CIGAR(false) {
+				_t.Errorf("inconsistent results, bytes: %d %s, uint16: %d %s",
+					r1.Score, r1.CIGAR(false), r2.Score, r2.CIGAR(false))
+			}
+
+			RecycleAlignmentResult(r1)
+			RecycleAlignmentResult(r2)
+			RecycleAligner(algn)
+		}
+	}
+
+	// words
+	algn := New(DefaultPenalties, DefaultOptions)
+	result, err := AlignGeneric(algn,
+		[]string{"the", "quick", "brown", "fox", "jumps", "over", "the", "lazy", "dog"},
+		[]string{"the", "quick", "red", "fox", "jumps", "over", "lazy", "dog"})
+	if err != nil {
+		_t.Error(err)
+		return
+	}
+	if result.CIGAR(false) != "2M1X3M1D2M" {
+		_t.Errorf("unexpected CIGAR: %s", result.CIGAR(false))
+	}
+	RecycleAlignmentResult(result)
+	RecycleAligner(algn)
+}
+
+func TestAlignMatcher(_t *testing.T) {
+	r := rand.New(rand.NewSource(2))
+
+	for i := 0; i < 20; i++ {
+		t := randSeq(r, 200+r.Intn(200))
+		q := mutate(r, t, 0.1)
+
+		for _, global := range []bool{true, false} {
+			algn := New(DefaultPenalties, &Options{GlobalAlignment: global})
+			algn.AdaptiveReduction(DefaultAdaptiveOption)
+
+			r1, err := algn.Align(q, t)
+			if err != nil {
+				_t.Error(err)
+				return
+			}
+			if i&1 == 1 { // it is ignored for matchers
+				algn.RepeatGapPenalties(DefaultRepeatGapPenalties)
+			}
+			r2, err := algn.AlignMatcher(len(q), len(t), MatchFunc(func(v, h int) bool { return q[v] == t[h] }))
+			if err != nil {
+				_t.Error(err)
+				return
+			}
+			if algn.gaps != nil {
+				_t.Errorf("repeat gap penalties should not be computed for matchers")
+			}
+			if r1.Score != r2.Score || r1.CIGAR(false) != r2.CIGAR(false) {
+				_t.Errorf("inconsistent results, bytes: %d %s, matcher: %d %s",
+					r1.Score, r1.CIGAR(false), r2.Score, r2.CIGAR(false))
+			}
+
+			RecycleAlignmentResult(r1)
+			RecycleAlignmentResult(r2)
+			RecycleAligner(algn)
+		}
+	}
+}
+
+func TestAlignPacked(_t *testing.T) {
+	r := rand.New(rand.NewSource(3))
+
+	for i := 0; i < 20; i++ {
+		t := randSeq(r, 100+r.Intn(300))
+		q := mutate(r, t, 0.1)
+		for j := 0; j < 3 && i&2 == 0; j++ { // some Ns
+			q[r.Intn(len(q))] = 'N'
+			t[r.Intn(len(t))] = 'N'
+		}
+
+		pq, pt := NewPackedSeq(bytes.ToLower(q)), NewPackedSeq(t)
+		if !bytes.Equal(pq.Bytes(), q) {
+			_t.Errorf("unpacked sequence mismatch")
+		}
+
+		for _, global := range []bool{true, false} {
+			algn := New(DefaultPenalties, &Options{GlobalAlignment: global})
+			algn.AdaptiveReduction(DefaultAdaptiveOption)
+			if i&1 == 1 {
+				algn.RepeatGapPenalties(DefaultRepeatGapPenalties)
+			}
+
+			r1, err := algn.Align(q, t)
+			if err != nil {
+				_t.Error(err)
+				return
+			}
+			r2, err := algn.AlignPacked(pq, pt)
+			if err != nil {
+				_t.Error(err)
+				return
+			}
+			if r1.Score != r2.Score || r1.CIGAR(false) != r2.CIGAR(false) {
+				_t.Errorf("inconsistent results, bytes: %d %s, packed: %d %s",
+					r1.Score, r1.CIGAR(false), r2.Score, r2.CIGAR(false))
+			}
+
+			RecycleAlignmentResult(r1)
+			RecycleAlignmentResult(r2)
+			RecycleAligner(algn)
+		}
+	}
+}
+
+func TestWaveFrontWindow(_t *testing.T) {
+	cpt := NewComponent()
+	defer RecycleComponent(cpt)
+
+	cpt.setKRangeHint(-2, 2)
+	for _, k := range []int{0, 2, -2, 5, -9, 100} { // the last three are out of the window
+		cpt.Set(3, k, uint32(k+10), wfaMatch)
+	}
+	for _, k := range []int{0, 2, -2, 5, -9, 100} {
+		offset, wfaType, ok := cpt.Get(3, k)
+		if !ok || offset != uint32(k+10) || wfaType != wfaMatch {
+			_t.Errorf("k: %d, unexpected offset: %d, %s, %v", k, offset, wfaType2str(wfaType), ok)
+		}
+	}
+	if _, _, ok := cpt.Get(3, 1); ok {
+		_t.Errorf("k: 1 should not exist")
+	}
+	if lo, hi := cpt.KRange(3, 0); lo != -9 || hi != 100 {
+		_t.Errorf("unexpected k range: [%d, %d]", lo, hi)
+	}
+
+	cpt.Reset()
+	if cpt.HasScore(3) {
+		_t.Errorf("wavefronts should be cleared after reset")
+	}
+}
+
+func TestAlignOneToMany(_t *testing.T) {
+	r := rand.New(rand.NewSource(4))
+
+	for _, global := range []bool{true, false} {
+		targets := make([][]byte, 50)
+		for i := range targets {
+			targets[i] = randSeq(r, 30+r.Intn(20))
+		}
+		q := bytes.ToLower(mutate(r, targets[17], 0.1))
+
+		algn := New(DefaultPenalties, &Options{GlobalAlignment: global})
+
+		// scores of each target
+		qu := bytes.ToUpper(q)
+		scores := make([]uint32, len(targets))
+		best := 0
+		for i, t := range targets {
+			result, err := algn.Align(qu, t)
+			if err != nil {
+				_t.Error(err)
+				return
+			}
+			scores[i] = result.Score
+			if scores[i] < scores[best] {
+				best = i
+			}
+			RecycleAlignmentResult(result)
+		}
+
+		hits, err := algn.AlignOneToMany(q, targets, &OneToManyOptions{MaxScore: -1, IgnoreCase: true})
+		if err != nil {
+			_t.Error(err)
+			return
+		}
+		if len(hits) != 1 || hits[0].Target != best || hits[0].Score != scores[best] {
+			_t.Errorf("unexpected best hit: %+v, expected: %d (%d)", hits, best, scores[best])
+		}
+		RecycleAlignmentResult(hits[0].AlignmentResult)
+
+		maxScore := 40
+		hits, err = algn.AlignOneToMany(q, targets, &OneToManyOptions{AllHits: true, MaxScore: maxScore, IgnoreCase: true})
+		if err != nil {
+			_t.Error(err)
+			return
+		}
+		var n int
+		for _, s := range scores {
+			if s <= uint32(maxScore) {
+				n++
+			}
+		}
+		if len(hits) != n {
+			_t.Errorf("unexpected number of hits: %d, expected: %d", len(hits), n)
+		}
+		for i, hit := range hits {
+			if hit.Score != scores[hit.Target] || (i > 0 && hit.Score < hits[i-1].Score) {
+				_t.Errorf("unexpected hit: %d %d", hit.Target, hit.Score)
+			}
+			RecycleAlignmentResult(hit.AlignmentResult)
+		}
+
+		RecycleAligner(algn)
+	}
+}
+
+func TestPairwiseDistances(_t *testing.T) {
+	r := rand.New(rand.NewSource(5))
+
+	seqs := make([][]byte, 7)
+	seqs[0] = randSeq(r, 60)
+	for i := 1; i < len(seqs); i++ {
+		seqs[i] = mutate(r, seqs[0], 0.1)
+	}
+	names := []string{"a", "b", "c", "d", "e", "f", "g"}
+
+	algn := New(DefaultPenalties, DefaultOptions)
+	for _, metric := range []DistanceMetric{DistanceScore, DistanceBLASTIdentity} {
+		m, err := PairwiseDistances(seqs, &DistanceOptions{Metric: metric, Threads: 3})
+		if err != nil {
+			_t.Error(err)
+			return
+		}
+		for i := range seqs {
+			for j := range seqs {
+				if i == j {
+					continue
+				}
+				result, err := algn.Align(seqs[i], seqs[j])
+				if err != nil {
+					_t.Error(err)
+					return
+				}
+				d := float64(result.Score)
+				if metric == DistanceBLASTIdentity {
+					d = 1 - result.Stats.BLASTIdentity()
+				}
+				// scores are symmetric, while identities might not be with different co-optimal alignments.
+				if (i < j || metric == DistanceScore) && m.Get(i, j) != d {
+					_t.Errorf("unexpected distance of %d vs %d: %f, expected: %f", i, j, m.Get(i, j), d)
+				}
+				RecycleAlignmentResult(result)
+			}
+		}
+
+		var buf bytes.Buffer
+		if err = m.WritePHYLIP(&buf, names); err != nil {
+			_t.Error(err)
+		}
+		lines := bytes.Split(bytes.TrimSpace(buf.Bytes()), []byte{'\n'})
+		if string(lines[0]) != "7" || len(lines) != 8 || !bytes.HasPrefix(lines[1], []byte("a          0 ")) {
+			_t.Errorf("unexpected PHYLIP output: %s", buf.Bytes())
+		}
+		if m.WritePHYLIP(&buf, names[1:]) != ErrInvalidNames || m.WriteTSV(&buf, names[1:]) != ErrInvalidNames {
+			_t.Errorf("mismatched names should be rejected")
+		}
+	}
+	RecycleAligner(algn)
+
+	if _, err := PairwiseDistances(seqs, &DistanceOptions{Metric: 100}); err != ErrInvalidDistanceMetric {
+		_t.Errorf("invalid metric should be rejected")
+	}
+}
+
+func TestAlignWithAnchors(_t *testing.T) {
+	r := rand.New(rand.NewSource(6))
+	t := randSeq(r, 5000)
+	q := mutate(r, t, 0.05)
+
+	anchors, err := FindAnchors(q, t, &SeedOptions{K: 15, W: 5})
+	if err != nil {
+		_t.Error(err)
+		return
+	}
+	chain := ChainAnchors(anchors)
+	if len(chain) < 10 {
+		_t.Errorf("too few anchors: %d", len(chain))
+	}
+	for i, a := range chain {
+		if !bytes.Equal(q[a.Q:a.Q+a.Len], t[a.T:a.T+a.Len]) {
+			_t.Errorf("anchor is not an exact match: %+v", a)
+		}
+		if i > 0 && (chain[i-1].Q+chain[i-1].Len > a.Q || chain[i-1].T+chain[i-1].Len > a.T) {
+			_t.Errorf("overlapping anchors: %+v, %+v", chain[i-1], a)
+		}
+	}
+
+	algn := New(DefaultPenalties, DefaultOptions)
+	result, err := algn.AlignWithAnchors(q, t, anchors)
+	if err != nil {
+		_t.Error(err)
+		return
+	}
+
+	// all bases are consumed and matches are real
+	var v, h int
+	for _, op := range result.Ops {
+		n := int(op & MaskLower32)
+		switch op >> 32 {
+		case OpM:
+			if !bytes.Equal(q[v:v+n], t[h:h+n]) {
+				_t.Errorf("invalid matches at %d, %d", v, h)
+			}
+			v += n
+			h += n
+		case OpX:
+			v += n
+			h += n
+		case OpI:
+			h += n
+		case OpD:
+			v += n
+		}
+	}
+	if v != len(q) || h != len(t) {
+		_t.Errorf("unexpected consumed bases: %d/%d, %d/%d", v, len(q), h, len(t))
+	}
+	if score := algn.Rescore(q, t, result); score != result.Score {
+		_t.Errorf("inconsistent score: %d, rescored: %d", result.Score, score)
+	}
+
+	full, err := algn.Align(q, t)
+	if err != nil {
+		_t.Error(err)
+		return
+	}
+	if result.Score < full.Score || float64(result.Score) > float64(full.Score)*1.1 {
+		_t.Errorf("unexpected score: %d, full alignment: %d", result.Score, full.Score)
+	}
+	RecycleAlignmentResult(full)
+	RecycleAlignmentResult(result)
+
+	if _, err = algn.AlignWithAnchors(q, t, []Anchor{{Q: 0, T: 1, Len: 100}}); err != ErrInvalidAnchor {
+		_t.Errorf("invalid anchor should be rejected")
+	}
+	RecycleAligner(algn)
+}
+
+func TestAlignWithConstraints(_t *testing.T) {
+	a := []byte("ACGATCAGGCATTCAGCTAT")
+	b := []byte("AGCTTACGATCGGATCCATG")
+	t := append(append(append([]byte{}, a...), "GGGGGG"...), b...)
+	q := append(append([]byte{}, a...), b...)
+
+	algn := New(DefaultPenalties, DefaultOptions)
+
+	// the deletion of GGGGGG is split into two pieces
+	result, err := algn.AlignWithConstraints(q, t, []Constraint{
+		{QBegin: 20, QEnd: 20, TBegin: 20, TEnd: 23},
+		{QBegin: 20, QEnd: 20, TBegin: 23, TEnd: 26},
+	})
+	if err != nil {
+		_t.Error(err)
+		return
+	}
+	if cigar := result.CIGAR(false); cigar != "20M6I20M" {
+		_t.Errorf("unexpected CIGAR: %s", cigar)
+	}
+
+	sum := (DefaultPenalties.GapOpen + DefaultPenalties.GapExt*3) * 2 // two pieces of 3I
+	if result.Score != sum-DefaultPenalties.GapOpen {
+		_t.Errorf("unexpected score: %d, sum of pieces: %d", result.Score, sum)
+	}
+	if result.QBegin != 1 || result.QEnd != 40 || result.TBegin != 1 || result.TEnd != 46 {
+		_t.Errorf("unexpected region: q[%d, %d], t[%d, %d]", result.QBegin, result.QEnd, result.TBegin, result.TEnd)
+	}
+	RecycleAlignmentResult(result)
+
+	// a constraint forcing a worse alignment
+	result, err = algn.AlignWithConstraints(q, t, []Constraint{{QBegin: 20, QEnd: 21, TBegin: 20, TEnd: 21}})
+	if err != nil {
+		_t.Error(err)
+		return
+	}
+	if cigar := result.CIGAR(false); cigar != "20M1X1M6I18M" {
+		_t.Errorf("unexpected CIGAR: %s", cigar)
+	}
+	RecycleAlignmentResult(result)
+
+	if _, err = algn.AlignWithConstraints(q, t, []Constraint{{QBegin: 5, QEnd: 10, TBegin: 5, TEnd: 10},
+		{QBegin: 8, QEnd: 12, TBegin: 10, TEnd: 12}}); err != ErrInvalidConstraint {
+		_t.Errorf("overlapping constraints should be rejected")
+	}
+	RecycleAligner(algn)
+}
+
+func TestEditAlignmentResult(_t *testing.T) {
+	a := []byte("ACGATCAGGCATTCAGCTAT")
+	b := []byte("TAGCTTACGATCGGATCCAT")
+
+	algn := New(DefaultPenalties, DefaultOptions)
+
+	x, err := algn.Align(a, append(append([]byte{}, a...), "GGG"...)) // 20M3I
+	if err != nil {
+		_t.Error(err)
+		return
+	}
+	y, err := algn.Align(b, append(append([]byte{}, b...), "GGG"...)) // 20M3I
+	if err != nil {
+		_t.Error(err)
+		return
+	}
+	y.Reverse() // 3I20M, i.e., the alignment of reversed b and GGG + reversed b
+	if cigar := y.CIGAR(false); cigar != "3I20M" || y.TBegin != 4 || y.TEnd != 23 {
+		_t.Errorf("unexpected reversed alignment: %s, t[%d, %d]", cigar, y.TBegin, y.TEnd)
+	}
+
+	score := x.Score + y.Score
+	x.Append(y, DefaultPenalties)
+	if cigar := x.CIGAR(false); cigar != "20M6I20M" || x.Score != score-DefaultPenalties.GapOpen ||
+		x.GapRegions != 1 || x.Stats.LongestGap != 6 || x.TEnd != 46 {
+		_t.Errorf("unexpected appended alignment: %s, score: %d, gap regions: %d", cigar, x.Score, x.GapRegions)
+	}
+	RecycleAlignmentResult(y)
+
+	s, tStart, tEnd, err := x.SliceQuery(11, 30, DefaultPenalties)
+	if err != nil {
+		_t.Error(err)
+		return
+	}
+	if cigar := s.CIGAR(false); cigar != "10M6I10M" || tStart != 11 || tEnd != 36 ||
+		s.Score != DefaultPenalties.GapOpen+DefaultPenalties.GapExt*6 {
+		_t.Errorf("unexpected query slice: %s, t[%d, %d], score: %d", cigar, tStart, tEnd, s.Score)
+	}
+	RecycleAlignmentResult(s)
+
+	s, qStart, qEnd, err := x.SliceTarget(19, 23, DefaultPenalties)
+	if err != nil {
+		_t.Error(err)
+		return
+	}
+	if cigar := s.CIGAR(false); cigar != "2M3I" || qStart != 19 || qEnd != 20 {
+		_t.Errorf("unexpected target slice: %s, q[%d, %d]", cigar, qStart, qEnd)
+	}
+	RecycleAlignmentResult(s)
+
+	if _, _, _, err = x.SliceQuery(30, 41, DefaultPenalties); err != ErrInvalidInterval {
+		_t.Errorf("invalid interval should be rejected")
+	}
+
+	score = x.Score
+	x.Invert()
+	if cigar := x.CIGAR(false); cigar != "20M6D20M" || x.Score != score || x.QEnd != 46 || x.TEnd != 40 ||
+		x.Stats.DeletedBases != 6 {
+		_t.Errorf("unexpected inverted alignment: %s, q[%d, %d], t[%d, %d]", cigar, x.QBegin, x.QEnd, x.TBegin, x.TEnd)
+	}
+	RecycleAlignmentResult(x)
+
+	RecycleAligner(algn)
+}
+
+func TestAlignCircular(_t *testing.T) {
+	r := rand.New(rand.NewSource(7))
+	t := randSeq(r, 3000)
+	m := mutate(r, t, 0.02)
+	q := RotateSeq(m, 700)
+
+	algn := New(DefaultPenalties, DefaultOptions)
+	full, err := algn.Align(m, t)
+	if err != nil {
+		_t.Error(err)
+		return
+	}
+
+	result, err := algn.AlignCircular(q, t)
+	if err != nil {
+		_t.Error(err)
+		return
+	}
+	if result.Rotation != len(m)-700 || result.Score > full.Score {
+		_t.Errorf("unexpected rotation: %d, score: %d, expected: %d, %d",
+			result.Rotation, result.Score, len(m)-700, full.Score)
+	}
+	if begin, end := result.CircularQueryRegion(len(q)); begin != result.Rotation+result.QBegin ||
+		end != (result.Rotation+result.QEnd-1)%len(q)+1 {
+		_t.Errorf("unexpected circular region: %d, %d", begin, end)
+	}
+
+	data, err := result.MarshalBinary()
+	if err != nil {
+		_t.Error(err)
+		return
+	}
+	result2 := NewAlignmentResult(true)
+	if err = result2.UnmarshalBinary(data); err != nil || result2.Rotation != result.Rotation {
+		_t.Errorf("rotation is not kept in serialization: %d, %v", result2.Rotation, err)
+	}
+
+	RecycleAlignmentResult(result2)
+	RecycleAlignmentResult(result)
+	RecycleAlignmentResult(full)
+	RecycleAligner(algn)
+
+	// the alignment is global even if the aligner is semi-global
+	t2 := append(t[:len(t):len(t)], randSeq(r, 100)...)
+	algn = New(DefaultPenalties, &Options{GlobalAlignment: true})
+	full, err = algn.AlignCircular(q, t2)
+	if err != nil {
+		_t.Error(err)
+		return
+	}
+	RecycleAligner(algn)
+	algn = New(DefaultPenalties, &Options{GlobalAlignment: false})
+	result, err = algn.AlignCircular(q, t2)
+	if err != nil {
+		_t.Error(err)
+		return
+	}
+	if result.Score != full.Score || algn.opt.GlobalAlignment {
+		_t.Errorf("unexpected score of semi-global aligner: %d, expected: %d", result.Score, full.Score)
+	}
+	RecycleAlignmentResult(result)
+	RecycleAlignmentResult(full)
+	RecycleAligner(algn)
+}
+
+func TestAlignGraph(_t *testing.T) {
+	gfa := `H	VN:Z:1.0
+S	s1	ACGTACGTTAGCATCGATCGGATC
+S	s2	A
+S	s3	G
+S	s4	TTAGCATGCATCGATTACGGCAT
+L	s1	+	s2	+	0M
+L	s1	+	s3	+	0M
+L	s2	+	s4	+	0M
+L	s3	+	s4	+	*
+`
+	g, err := ParseGFA(strings.NewReader(gfa))
+	if err != nil {
+		_t.Error(err)
+		return
+	}
+
+	algn := New(DefaultPenalties, DefaultOptions)
+	opt := &SeedOptions{K: 11, W: 5}
+
+	// a SNP in s4, and the reverse complement strand
+	q := []byte("GTTAGCATCGATCGGATC" + "G" + "TTAGCATGCTTCGATTACGG")
+	for _, rc := range []bool{false, true} {
+		if rc {
+			q = revComp(q)
+		}
+		ga, err := algn.AlignGraph(g, q, opt)
+		if err != nil {
+			_t.Error(err)
+			return
+		}
+
+		var buf bytes.Buffer
+		if err = g.WriteGAF(&buf, "q", len(q), ga); err != nil {
+			_t.Error(err)
+		}
+		expected := "q\t39\t0\t39\t+\t>s1>s3>s4\t48\t6\t45\t38\t39\t255\tNM:i:1\tcg:Z:28=1X10=\n"
+		if rc {
+			expected = "q\t39\t0\t39\t+\t<s4<s3<s1\t48\t3\t42\t38\t39\t255\tNM:i:1\tcg:Z:10=1X28=\n"
+		}
+		if buf.String() != expected {
+			_t.Errorf("unexpected GAF record: %s", buf.String())
+		}
+
+		if score := algn.Rescore(q, g.PathSeq(ga.Path)[ga.PathStart:ga.PathEnd], ga.AlignmentResult); score != ga.Score {
+			_t.Errorf("inconsistent score: %d, rescored: %d", ga.Score, score)
+		}
+		RecycleAlignmentResult(ga.AlignmentResult)
+	}
+
+	if _, err = algn.AlignGraph(g, []byte("CCCCCCCCCCCCCCCC"), opt); err != ErrNoAnchor {
+		_t.Errorf("query without anchors should be rejected")
+	}
+	RecycleAligner(algn)
+}
+
+func TestPOA(_t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	ref := randSeq(r, 500)
+
+	poa := NewPOA(DefaultPenalties)
+	reads := make([][]byte, 20)
+	for i := range reads {
+		reads[i] = mutate(r, ref, 0.05)
+		if err := poa.Add(reads[i]); err != nil {
+			_t.Error(err)
+			return
+		}
+	}
+
+	if consensus := poa.Consensus(); !bytes.Equal(consensus, ref) {
+		_t.Errorf("unexpected consensus:\n%s\n%s", consensus, ref)
+	}
+
+	rows := poa.MSA()
+	for i, row := range rows {
+		if len(row) != len(rows[0]) {
+			_t.Errorf("rows of MSA should have the same length")
+		}
+		if !bytes.Equal(bytes.ReplaceAll(row, []byte{'-'}, nil), reads[i]) {
+			_t.Errorf("unexpected MSA row %d: %s", i, row)
+		}
+	}
+
+	if err := poa.Add(nil); err != ErrEmptySeq {
+		_t.Errorf("empty read should be rejected")
+	}
+}
+
+func TestAlignCoOptimal(_t *testing.T) {
+	algn := New(DefaultPenalties, DefaultOptions)
+
+	// the deleted A could be any of the last two As
+	q := []byte("AAC")
+	t := []byte("AAAC")
+	results, total, err := algn.AlignCoOptimal(q, t, 10)
+	if err != nil {
+		_t.Error(err)
+		return
+	}
+	if total != 2 || len(results) != 2 || results[0].CIGAR(false) == results[1].CIGAR(false) {
+		_t.Errorf("unexpected co-optimal alignments: %d, %d", len(results), int(total))
+	}
+	for _, res := range results {
+		RecycleAlignmentResult(res)
+	}
+	if _, _, err = algn.AlignCoOptimal(q, t, -1); err != ErrInvalidNumberOfAlignments {
+		_t.Errorf("negative n is not rejected: %v", err)
+	}
+	if _, err = algn.SampleCoOptimal(q, t, 0, nil); err != ErrInvalidNumberOfAlignments {
+		_t.Errorf("zero n is not rejected: %v", err)
+	}
+
+	r := rand.New(rand.NewSource(1))
+	for _, global := range []bool{true, false} {
+		opt := *DefaultOptions
+		opt.GlobalAlignment = global
+		algn2 := New(DefaultPenalties, &opt)
+		for i := 0; i < 200; i++ {
+			t = randSeq(r, 1+r.Intn(60))
+			q = mutate(r, t, 0.2)
+			if !global && i&1 == 1 && len(q) > 1 { // a prefix, ending with trailing insertions
+				q = q[:1+r.Intn(len(q)-1)]
+			}
+			if len(q) == 0 {
+				continue
+			}
+
+			result, err := algn2.Align(q, t)
+			if err != nil {
+				_t.Error(err)
+				return
+			}
+			results, total, err = algn2.AlignCoOptimal(q, t, 100)
+			if err != nil {
+				_t.Error(err)
+				return
+			}
+			samples, err := algn2.SampleCoOptimal(q, t, 5, r)
+			if err != nil {
+				_t.Error(err)
+				return
+			}
+			if total < 1 || len(results) != int(min(total, 100)) {
+				_t.Errorf("unexpected number of co-optimal alignments: %d, %f", len(results), total)
+			}
+
+			cigars := make(map[string]bool, len(results))
+			for _, res := range results {
+				cigars[res.CIGAR(false)] = true
+			}
+			if len(cigars) != len(results) {
+				_t.Errorf("duplicated co-optimal alignments")
+			}
+			if total <= 100 && !cigars[result.CIGAR(false)] {
+				_t.Errorf("the alignment %s is not in co-optimal alignments", result.CIGAR(false))
+			}
+			for _, res := range append(results, samples...) {
+				if res.Score != result.Score || algn2.Rescore(q, t, res) != res.Score {
+					_t.Errorf("unexpected score: %d, rescore: %d, expected: %d, cigar: %s",
+						res.Score, algn2.Rescore(q, t, res), result.Score, res.CIGAR(false))
+				}
+			}
+			RecycleAlignmentResult(result)
+			for _, res := range append(results, samples...) {
+				RecycleAlignmentResult(res)
+			}
+		}
+		RecycleAligner(algn2)
+	}
+
+	RecycleAligner(algn)
+}
+
+func TestPlot(_t *testing.T) {
+	algn := New(DefaultPenalties, DefaultOptions)
+	q := []byte("ACGTTAGGACCATA")
+	t := []byte("ACGTAGGATCCATTA")
+	result, err := algn.Align(q, t)
+	if err != nil {
+		_t.Error(err)
+		return
+	}
+
+	opt := *DefaultPlotOptions
+	opt.Path = result
+	var bufM, bufI bytes.Buffer
+	algn.PlotWithOptions(&q, &t, &bufM, algn.M, &opt)
+	algn.PlotWithOptions(&q, &t, &bufI, algn.I, &opt)
+	if bytes.Equal(bufM.Bytes(), bufI.Bytes()) {
+		_t.Errorf("the chosen component is not plotted")
+	}
+	if n := bytes.Count(bufM.Bytes(), []byte("*")); n != len(q)+1 { // 4M2X1M2X4M1I1M
+		_t.Errorf("unexpected number of cells in the path: %d", n)
+	}
+
+	// a region
+	bufM.Reset()
+	opt.QBegin, opt.QEnd, opt.TBegin, opt.TEnd = 3, 8, 4, 10
+	algn.PlotWithOptions(&q, &t, &bufM, algn.M, &opt)
+	if n := bytes.Count(bufM.Bytes(), []byte("\n")); n != 2+6 {
+		_t.Errorf("unexpected number of lines: %d", n)
+	}
+	if n := bytes.Count(bufM.Bytes(), []byte("*")); n != 5 {
+		_t.Errorf("unexpected number of cells in the path: %d", n)
+	}
+
+	RecycleAlignmentResult(result)
+	RecycleAligner(algn)
+}
+
+func TestPlotHTMLAndSVG(_t *testing.T) {
+	algn := New(DefaultPenalties, DefaultOptions)
+	algn.AdaptiveReduction(DefaultAdaptiveOption)
+	algn.RecordPruned(true)
+
+	r := rand.New(rand.NewSource(1))
+	t := randSeq(r, 5000)
+	q := mutate(r, t, 0.05)
+	result, err := algn.Align(q, t)
+	if err != nil {
+		_t.Error(err)
+		return
+	}
+	if len(algn.pruned) == 0 {
+		_t.Errorf("no pruned diagonals are recorded")
+	}
+
+	var buf bytes.Buffer
+	opt := *DefaultSVGPlotOptions
+	opt.Path = result
+	if err = algn.PlotSVG(&q, &t, &buf, &opt); err != nil {
+		_t.Error(err)
+		return
+	}
+	if !bytes.Contains(buf.Bytes(), []byte("<polyline")) || !bytes.Contains(buf.Bytes(), []byte("#bdbdbd")) {
+		_t.Errorf("the alignment path or pruned diagonals are not plotted")
+	}
+
+	buf.Reset()
+	popt := *DefaultPlotOptions
+	popt.Path = result
+	popt.QEnd, popt.TEnd = 20, 20
+	if err = algn.PlotHTML(&q, &t, &buf, algn.M, &popt); err != nil {
+		_t.Error(err)
+		return
+	}
+	if n := bytes.Count(buf.Bytes(), []byte("<tr>")); n != 8+2+20 { // legend, header, rows
+		_t.Errorf("unexpected number of rows: %d", n)
+	}
+
+	RecycleAlignmentResult(result)
+	RecycleAligner(algn)
+}
+
+func TestAlignerStats(_t *testing.T) {
+	algn := New(DefaultPenalties, DefaultOptions)
+	algn.AdaptiveReduction(DefaultAdaptiveOption)
+	var stats AlignerStats
+	algn.CollectStats(&stats)
+	var steps int
+	var lastS uint32
+	algn.Observe(func(s uint32, lo, hi int) {
+		if lo > hi {
+			_t.Errorf("unexpected k range of score %d: [%d, %d]", s, lo, hi)
+		}
+		steps++
+		lastS = s
+	})
+
+	r := rand.New(rand.NewSource(1))
+	t := randSeq(r, 5000)
+	q := mutate(r, t, 0.05)
+	result, err := algn.Align(q, t)
+	if err != nil {
+		_t.Error(err)
+		return
+	}
+	if stats.Steps != steps || steps == 0 || steps > int(result.Score)+1 || lastS != result.Score {
+		_t.Errorf("unexpected steps: %d, observed: %d, last score: %d, score: %d",
+			stats.Steps, steps, lastS, result.Score)
+	}
+	if stats.WaveFronts == 0 || stats.Cells == 0 || stats.BasesCompared < len(q) ||
+		stats.PrunedDiagonals == 0 || stats.PeakMemory == 0 {
+		_t.Errorf("unexpected stats: %+v", stats)
+	}
+
+	// counters are accumulated
+	pre := stats
+	result2, err := algn.Align(q, t)
+	if err != nil {
+		_t.Error(err)
+		return
+	}
+	if stats.Steps != 2*pre.Steps || stats.Cells != 2*pre.Cells || stats.PeakMemory != pre.PeakMemory {
+		_t.Errorf("unexpected accumulated stats: %+v", stats)
+	}
+
+	RecycleAlignmentResult(result)
+	RecycleAlignmentResult(result2)
+	RecycleAligner(algn)
+}
+
+func TestRecycleAlignerTrim(_t *testing.T) {
+	r := rand.New(rand.NewSource(37))
+	t := randSeq(r, 5000)
+	q := mutate(r, t, 0.1)
+
+	algn := New(DefaultPenalties, &Options{GlobalAlignment: true})
+	result, err := algn.Align(q, t)
+	if err != nil {
+		_t.Error(err)
+		return
+	}
+	RecycleAlignmentResult(result)
+
+	M := algn.M
+	if M.arena.size() <= ARENA_MAX_POOLED_SIZE || len(M.WaveFronts) <= WAVEFRONTS_BASE_SIZE {
+		_t.Skipf("the alignment is too small to test trimming")
+	}
+
+	RecycleAligner(algn)
+	var n int
+	for _, c := range M.arena.chunks {
+		n += len(c)
+	}
+	if n > ARENA_MAX_POOLED_SIZE || len(M.WaveFronts) > WAVEFRONTS_BASE_SIZE || len(M.blocks) > 1 {
+		_t.Errorf("component not trimmed: arena %d, wavefronts %d, blocks %d", n, len(M.WaveFronts), len(M.blocks))
+	}
+}
+
+// benchSeqs returns a pair of sequences of length n with a divergence.
+func benchSeqs(n int, divergence float64) ([]byte, []byte) {
+	r := rand.New(rand.NewSource(1))
+	t := randSeq(r, n)
+	return mutate(r, t, divergence), t
+}
+
+var benchCases = []struct {
+	n          int
+	divergence float64
+}{
+	{20000, 0.05},
+	{20000, 0.01},
+	{100000, 0.001},
+	{1000000, 0.0001},
+}
+
+func BenchmarkAlign(b *testing.B) {
+	for _, c := range benchCases {
+		q, t := benchSeqs(c.n, c.divergence)
+		b.Run(fmt.Sprintf("%d-%g", c.n, c.divergence), func(b *testing.B) {
+			algn := New(DefaultPenalties, DefaultOptions)
+			for i := 0; i < b.N; i++ {
+				result, _ := algn.Align(q, t)
+				RecycleAlignmentResult(result)
+			}
+			RecycleAligner(algn)
+		})
+	}
+}
+
+func BenchmarkAlignPacked(b *testing.B) {
+	for _, c := range benchCases {
+		q, t := benchSeqs(c.n, c.divergence)
+		pq, pt := NewPackedSeq(q), NewPackedSeq(t)
+		b.Run(fmt.Sprintf("%d-%g", c.n, c.divergence), func(b *testing.B) {
+			algn := New(DefaultPenalties, DefaultOptions)
+			for i := 0; i < b.N; i++ {
+				result, _ := algn.AlignPacked(pq, pt)
+				RecycleAlignmentResult(result)
+			}
+			RecycleAligner(algn)
+		})
+	}
+}
@@ -0,0 +1,209 @@
+// Copyright © 2024 Wei Shen <shenwei356@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package wfa
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+)
+
+// VariantType is the type of a variant.
+type VariantType uint8
+
+const (
+	VariantSNV       VariantType = iota + 1 // single-nucleotide variant
+	VariantMNV                              // multiple-nucleotide variant
+	VariantInsertion                        // bases only in the query, i.e., "D" in CIGAR
+	VariantDeletion                         // bases only in the target, i.e., "I" in CIGAR
+	VariantComplex                          // mismatches and gaps next to each other
+)
+
+func (vt VariantType) String() string {
+	switch vt {
+	case VariantSNV:
+		return "SNV"
+	case VariantMNV:
+		return "MNV"
+	case VariantInsertion:
+		return "INS"
+	case VariantDeletion:
+		return "DEL"
+	case VariantComplex:
+		return "COMPLEX"
+	default:
+		return "N/A"
+	}
+}
+
+// Variant is a variant of the query relative to the target (reference).
+// Adjacent mismatches and gaps are reported as one variant.
+// For pure indels, Ref and Alt contain an anchor base before the indel (the VCF convention),
+// or after it if the indel is at the beginning of the target.
+type Variant struct {
+	Type VariantType
+	Pos  int    // 1-based position in the target, the position of the first base of Ref.
+	QPos int    // 1-based position in the query, the position of the first base of Alt.
+	Ref  []byte // Reference allele
+	Alt  []byte // Alternate allele
+}
+
+// Variants extracts SNVs, MNVs, indels and complex variants from an alignment.
+// q and t are the query and target sequences used in the alignment,
+// and the target is regarded as the reference.
+// For semi-global alignment, flanking insertions and clippings are not reported.
+func (cigar *AlignmentResult) Variants(q, t *[]byte) []*Variant {
+	cigar.process()
+	ops := cigar.Ops
+
+	begin, end := 0, len(ops)-1
+	if !cigar.globalAlignment {
+		for begin < len(ops) && !isMatchOrMismatch(ops[begin]) {
+			begin++
+		}
+		for end >= 0 && !isMatchOrMismatch(ops[end]) {
+			end--
+		}
+	}
+
+	variants := make([]*Variant, 0, 8)
+	var v, h int   // 0-based positions of the next bases
+	var v0, h0 int // start positions of the current block of mismatches and gaps
+	var inBlock, hasX, hasGap bool
+	var n int
+	for i, op := range ops {
+		n = int(op & MaskLower32)
+		if i < begin || i > end {
+			switch op >> 32 {
+			case OpI:
+				h += n
+			case OpH, OpD:
+				v += n
+			}
+			continue
+		}
+
+		switch op >> 32 {
+		case OpM:
+			if inBlock {
+				variants = append(variants, newVariant(q, t, v0, v, h0, h, hasX, hasGap))
+				inBlock, hasX, hasGap = false, false, false
+			}
+			v += n
+			h += n
+			continue
+		case OpH:
+			v += n
+			continue
+		}
+
+		if !inBlock {
+			inBlock = true
+			v0, h0 = v, h
+		}
+		switch op >> 32 {
+		case OpX:
+			hasX = true
+			v += n
+			h += n
+		case OpI:
+			hasGap = true
+			h += n
+		case OpD:
+			hasGap = true
+			v += n
+		}
+	}
+	if inBlock {
+		variants = append(variants, newVariant(q, t, v0, v, h0, h, hasX, hasGap))
+	}
+	return variants
+}
+
+// newVariant creates a variant from the aligned block q[v0:v1] and t[h0:h1].
+func newVariant(q, t *[]byte, v0, v1, h0, h1 int, hasX, hasGap bool) *Variant {
+	vr := &Variant{
+		Pos:  h0 + 1,
+		QPos: v0 + 1,
+		Ref:  append([]byte{}, (*t)[h0:h1]...),
+		Alt:  append([]byte{}, (*q)[v0:v1]...),
+	}
+
+	if !hasGap {
+		vr.Type = VariantSNV
+		if h1-h0 > 1 {
+			vr.Type = VariantMNV
+		}
+		return vr
+	}
+	if v1 > v0 && h1 > h0 {
+		vr.Type = VariantComplex
+		return vr
+	}
+
+	if h1 == h0 {
+		vr.Type = VariantInsertion
+	} else {
+		vr.Type = VariantDeletion
+	}
+	// add an anchor base, which is the same in the query and the target.
+	if h0 > 0 {
+		vr.Pos, vr.QPos = h0, v0
+		vr.Ref = append([]byte{(*t)[h0-1]}, vr.Ref...)
+		vr.Alt = append([]byte{(*t)[h0-1]}, vr.Alt...)
+	} else if h1 < len(*t) {
+		vr.Ref = append(vr.Ref, (*t)[h1])
+		vr.Alt = append(vr.Alt, (*t)[h1])
+	}
+	return vr
+}
+
+// VCFContig is a contig declared in the VCF header.
+type VCFContig struct {
+	ID     string
+	Length int
+}
+
+// WriteVCFHeader writes a minimal VCF 4.2 header, with ##contig lines for the given contigs.
+func WriteVCFHeader(w io.Writer, contigs ...VCFContig) error {
+	bw := bufio.NewWriter(w)
+	bw.WriteString(`##fileformat=VCFv4.2
+##source=github.com/shenwei356/wfa
+`)
+	for _, c := range contigs {
+		fmt.Fprintf(bw, "##contig=<ID=%s,length=%d>\n", c.ID, c.Length)
+	}
+	bw.WriteString(`##INFO=<ID=TYPE,Number=1,Type=String,Description="Variant type: SNV, MNV, INS, DEL, COMPLEX">
+##INFO=<ID=QPOS,Number=1,Type=Integer,Description="1-based position of ALT in the query">
+#CHROM	POS	ID	REF	ALT	QUAL	FILTER	INFO
+`)
+	return bw.Flush()
+}
+
+// WriteVCF writes variants as VCF records, chrom is the name of the target sequence.
+func WriteVCF(w io.Writer, chrom string, variants []*Variant) error {
+	bw := bufio.NewWriter(w)
+	for _, vr := range variants {
+		fmt.Fprintf(bw, "%s\t%d\t.\t%s\t%s\t.\t.\tTYPE=%s;QPOS=%d\n",
+			chrom, vr.Pos, vr.Ref, vr.Alt, vr.Type, vr.QPos)
+	}
+	return bw.Flush()
+}
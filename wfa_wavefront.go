@@ -27,34 +27,39 @@ import (
 	"sync"
 )
 
-// OFFSETS_BASE_SIZE is the base size of the offset slice.
+// OFFSETS_BASE_SIZE is the base size of the offset window of a standalone wavefront.
 var OFFSETS_BASE_SIZE = 128
 
-var _OFFSETS_GROW_SLICE = make([]uint32, OFFSETS_BASE_SIZE)
+// ARENA_CHUNK_SIZE is the size of the first chunk of an arena, following chunks are larger.
+var ARENA_CHUNK_SIZE = 1 << 16
 
 // WaveFront is a list of offsets for different k values.
 // We also use the low 3 bits to store the backtrace type.
 //
-// Since k might be negative and usually the values are symmetrical,
-// we store them like this:
+// Offsets is a contiguous window of k values, starting from an internal base k:
 //
-//	index: 0,  1,  2,  3,  4,  5,  6
-//	k:     0, -1,  1, -2,  2, -3,  3
+//	index: 0,      1,      2,      ...
+//	k:     base, base+1, base+2, ...
 //
 // if the value is 0, it means there's no records for that k.
 type WaveFront struct {
 	Lo, Hi  int      // Lowest and Highest k.
-	Offsets []uint32 // offset data. We preset 2048 values to avoid frequent append operation.
+	Offsets []uint32 // offset data, usually it's a window in the arena of a component.
+
+	base  int // k of the first offset.
+	arena *arena
 }
 
-// NewWaveFront creates a new WaveFront object.
+// NewWaveFront creates a new standalone WaveFront object.
 // If you do not need it, do not remember to use RecycleWaveFront() to recycle it.
 func NewWaveFront() *WaveFront {
 	wf := poolWaveFront.Get().(*WaveFront)
 	wf.Lo = math.MaxInt
 	wf.Hi = math.MinInt
+	wf.base = -OFFSETS_BASE_SIZE >> 1
 	wf.Offsets = wf.Offsets[:OFFSETS_BASE_SIZE] // reset the length to the base size
 	clear(wf.Offsets)                           // reset all values as 0's.
+	wf.arena = nil
 
 	return wf
 }
@@ -68,56 +73,51 @@ var poolWaveFront = &sync.Pool{New: func() interface{} {
 
 // RecycleWaveFront recycles a WaveFront.
 func RecycleWaveFront(wf *WaveFront) {
-	if wf != nil {
+	if wf != nil && wf.arena == nil {
 		poolWaveFront.Put(wf)
 	}
 }
 
-// convert k to slice index.
-func k2i(k int) int {
-	if k >= 0 {
-		return k << 1
-	}
-	return ((-k) << 1) - 1
-}
-
-// Set sets an offset with a given backtrace type.
-func (wf *WaveFront) Set(k int, offset uint32, wfaType uint32) {
-	i := k2i(k)
-	if i >= len(wf.Offsets) { // grow the slice
-		n := (i - len(wf.Offsets) + OFFSETS_BASE_SIZE) / OFFSETS_BASE_SIZE
-		for j := 0; j < n; j++ {
-			wf.Offsets = append(wf.Offsets, _OFFSETS_GROW_SLICE...)
+// grow enlarges the window to contain k.
+func (wf *WaveFront) grow(k int) {
+	lo, hi := k, k
+	if n := len(wf.Offsets); n > 0 { // at least doubling the size
+		lo, hi = wf.base, wf.base+n-1
+		if k < lo {
+			lo = min(k, lo-n)
+		} else {
+			hi = max(k, hi+n)
 		}
 	}
-	wf.Offsets[i] = offset<<wfaTypeBits | wfaType
 
-	// update k range
-	// wf.Lo = min(wf.Lo, k)
-	// wf.Hi = max(wf.Hi, k)
-	if k < wf.Lo {
-		wf.Lo = k
+	var w []uint32
+	if wf.arena != nil {
+		w = wf.arena.alloc(hi - lo + 1)
+	} else {
+		w = make([]uint32, hi-lo+1)
 	}
-	if k > wf.Hi {
-		wf.Hi = k
+	if len(wf.Offsets) > 0 {
+		copy(w[wf.base-lo:], wf.Offsets)
 	}
+	wf.base, wf.Offsets = lo, w
+}
+
+// Set sets an offset with a given backtrace type.
+func (wf *WaveFront) Set(k int, offset uint32, wfaType uint32) {
+	wf.SetRaw(k, offset<<wfaTypeBits|wfaType)
 }
 
 // Set sets an offset which has already contain a backtrace type.
 // Here, offsetWithType = offset<<wfaTypeBits | wfaType.
 func (wf *WaveFront) SetRaw(k int, offsetWithType uint32) {
-	i := k2i(k)
-	if i >= len(wf.Offsets) { // grow the slice
-		n := (i - len(wf.Offsets) + OFFSETS_BASE_SIZE) / OFFSETS_BASE_SIZE
-		for j := 0; j < n; j++ {
-			wf.Offsets = append(wf.Offsets, _OFFSETS_GROW_SLICE...)
-		}
+	i := k - wf.base
+	if uint(i) >= uint(len(wf.Offsets)) { // out of the window
+		wf.grow(k)
+		i = k - wf.base
 	}
 	wf.Offsets[i] = offsetWithType
 
 	// update k range
-	// wf.Lo = min(wf.Lo, k)
-	// wf.Hi = max(wf.Hi, k)
 	if k < wf.Lo {
 		wf.Lo = k
 	}
@@ -129,18 +129,14 @@ func (wf *WaveFront) SetRaw(k int, offsetWithType uint32) {
 // Increase increases the offset by delta.
 // Here delta does not contain the backtrace type.
 func (wf *WaveFront) Increase(k int, delta uint32) {
-	i := k2i(k)
-	if i >= len(wf.Offsets) { // grow the slice
-		n := (i - len(wf.Offsets) + OFFSETS_BASE_SIZE) / OFFSETS_BASE_SIZE
-		for j := 0; j < n; j++ {
-			wf.Offsets = append(wf.Offsets, _OFFSETS_GROW_SLICE...)
-		}
+	i := k - wf.base
+	if uint(i) >= uint(len(wf.Offsets)) { // out of the window
+		wf.grow(k)
+		i = k - wf.base
 	}
 	wf.Offsets[i] += delta << wfaTypeBits
 
 	// update k range
-	// wf.Lo = min(wf.Lo, k)
-	// wf.Hi = max(wf.Hi, k)
 	if k < wf.Lo {
 		wf.Lo = k
 	}
@@ -154,7 +150,7 @@ func (wf *WaveFront) Get(k int) (uint32, uint32, bool) {
 	if k < wf.Lo || k > wf.Hi { // check k range
 		return 0, 0, false
 	}
-	offset := wf.Offsets[k2i(k)]
+	offset := wf.Offsets[k-wf.base]
 	return offset >> wfaTypeBits, offset & wfaTypeMask, offset > 0
 }
 
@@ -163,7 +159,7 @@ func (wf *WaveFront) GetRaw(k int) (uint32, bool) {
 	if k < wf.Lo || k > wf.Hi { // check k range
 		return 0, false
 	}
-	offset := wf.Offsets[k2i(k)]
+	offset := wf.Offsets[k-wf.base]
 	return offset, offset > 0
 }
 
@@ -172,7 +168,7 @@ func (wf *WaveFront) Delete(k int) {
 	if k < wf.Lo || k > wf.Hi { // check k range
 		return
 	}
-	wf.Offsets[k2i(k)] = 0
+	wf.Offsets[k-wf.base] = 0
 
 	// update k range
 	if k == wf.Hi {
@@ -196,3 +192,53 @@ func (wf *WaveFront) String() string {
 	}
 	return buf.String()
 }
+
+// arena allocates offset windows of wavefronts from large chunks,
+// which are reused between alignments.
+type arena struct {
+	chunks [][]uint32
+	i      int // index of the current chunk
+	j      int // used size of the current chunk
+}
+
+// alloc returns a zeroed slice of n values.
+func (a *arena) alloc(n int) []uint32 {
+	var c []uint32
+	for a.i < len(a.chunks) {
+		c = a.chunks[a.i]
+		if a.j+n <= len(c) {
+			w := c[a.j : a.j+n : a.j+n]
+			a.j += n
+			clear(w)
+			return w
+		}
+		a.i++
+		a.j = 0
+	}
+
+	size := ARENA_CHUNK_SIZE
+	if len(a.chunks) > 0 { // larger chunks for long sequences
+		size = min(len(a.chunks[len(a.chunks)-1])<<1, ARENA_CHUNK_SIZE<<6)
+	}
+	c = make([]uint32, max(size, n))
+	a.chunks = append(a.chunks, c)
+	a.i, a.j = len(a.chunks)-1, n
+	return c[:n:n]
+}
+
+// trim releases chunks after the total size exceeds max, and makes the rest reusable.
+func (a *arena) trim(max int) {
+	var n, i int
+	for i < len(a.chunks) && n+len(a.chunks[i]) <= max {
+		n += len(a.chunks[i])
+		i++
+	}
+	clear(a.chunks[i:])
+	a.chunks = a.chunks[:i]
+	a.reset()
+}
+
+// reset makes all chunks reusable.
+func (a *arena) reset() {
+	a.i, a.j = 0, 0
+}